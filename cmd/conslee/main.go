@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -12,8 +14,11 @@ import (
 	"syscall"
 	"time"
 
+	"conslee/internal/auth"
 	"conslee/internal/config"
+	"conslee/internal/logging"
 	"conslee/internal/proxy"
+	"conslee/internal/tracing"
 )
 
 var (
@@ -21,14 +26,54 @@ var (
 	serverMu       sync.Mutex
 )
 
+func runHashPassword() {
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatalf("read password: %v", err)
+	}
+	hash, err := auth.HashPassword(strings.TrimRight(line, "\r\n"))
+	if err != nil {
+		log.Fatalf("hash password: %v", err)
+	}
+	fmt.Println(hash)
+}
+
+func runGenerateToken() {
+	token, err := auth.GenerateToken()
+	if err != nil {
+		log.Fatalf("generate token: %v", err)
+	}
+	fmt.Printf("token: %s\nhash:  %s\n", token, auth.HashToken(token))
+}
+
 func main() {
 	configPath := flag.String("config", "config/config.yml", "path to config file")
+	hashPassword := flag.Bool("hash-password", false, "read a password from stdin, print its bcrypt hash and exit")
+	generateToken := flag.Bool("generate-token", false, "print a new API token and its hash and exit")
 	flag.Parse()
 
+	if *hashPassword {
+		runHashPassword()
+		return
+	}
+	if *generateToken {
+		runGenerateToken()
+		return
+	}
+
 	cfg, err := config.Load(*configPath)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if err := logging.Setup(cfg.Log); err != nil {
+		log.Fatalf("failed to set up logging: %v", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
 
 	p, err := proxy.New(cfg, *configPath)
 	if err != nil {
@@ -36,22 +81,79 @@ func main() {
 	}
 
 	mux := http.NewServeMux()
+	api := http.NewServeMux()
+	authMgr := p.Auth()
+
+	// Auth routes (unauthenticated)
+	mux.HandleFunc("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		authMgr.CheckOrigin(authMgr.HandleLogin)(w, r)
+	})
+	mux.HandleFunc("/api/auth/logout", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		authMgr.CheckOrigin(authMgr.HandleLogout)(w, r)
+	})
+	mux.HandleFunc("/api/auth/continue", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		authMgr.HandleContinue(w, r)
+	})
+	mux.HandleFunc("/api/auth/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		authMgr.HandleMe(w, r)
+	})
+
+	mux.HandleFunc("/api/auth/oidc/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		authMgr.HandleOIDCLogin(w, r)
+	})
+	mux.HandleFunc("/api/auth/oidc/callback", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		authMgr.HandleOIDCCallback(w, r)
+	})
+
+	// API routes (authenticated). Other /api/ paths belong to proxied
+	// services and are passed through.
+	protected := authMgr.Middleware(api)
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := api.Handler(r); pattern == "" {
+			p.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
 
-	// API routes
 	// /api/services
-	mux.HandleFunc("/api/services", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/api/services", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			p.HandleListServices(w, r)
 		case http.MethodPost:
-			p.HandleCreateService(w, r)
+			auth.RequireRole(auth.RoleAdmin, p.HandleCreateService)(w, r)
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
-	// /api/services/... – start/stop/settings/delete
-	mux.HandleFunc("/api/services/", func(w http.ResponseWriter, r *http.Request) {
+	// /api/services/... – start/stop/events/logs/settings/delete
+	api.HandleFunc("/api/services/", func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 
 		if strings.HasSuffix(path, "/start") && r.Method == http.MethodPost {
@@ -62,6 +164,14 @@ func main() {
 			p.HandleStopService(w, r)
 			return
 		}
+		if strings.HasSuffix(path, "/logs") && r.Method == http.MethodGet {
+			p.HandleServiceLogs(w, r)
+			return
+		}
+		if strings.HasSuffix(path, "/events") && r.Method == http.MethodGet {
+			p.HandleServiceEvents(w, r)
+			return
+		}
 		if strings.HasSuffix(path, "/settings") && r.Method == http.MethodPost {
 			p.HandleUpdateService(w, r)
 			return
@@ -74,36 +184,63 @@ func main() {
 		http.Error(w, "not found", http.StatusNotFound)
 	})
 
-	mux.HandleFunc("/api/docker/containers", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/api/docker/containers", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		p.HandleListContainers(w, r)
+		auth.RequireRole(auth.RoleOperator, p.HandleListContainers)(w, r)
+	})
+
+	// GET /api/audit
+	api.HandleFunc("/api/audit", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p.HandleAudit(w, r)
+	})
+
+	// GET /api/events
+	api.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p.HandleEvents(w, r)
+	})
+
+	// GET /api/reports/savings
+	api.HandleFunc("/api/reports/savings", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p.HandleSavingsReport(w, r)
 	})
 
 	// GET /api/system, POST /api/system
-	mux.HandleFunc("/api/system", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/api/system", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			p.HandleGetSystem(w, r)
 		case http.MethodPost:
-			p.HandleUpdateSystem(w, r)
+			auth.RequireRole(auth.RoleAdmin, p.HandleUpdateSystem)(w, r)
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
 	// GET /api/system/check-port
-	mux.HandleFunc("/api/system/check-port", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/api/system/check-port", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		p.HandleCheckPort(w, r)
+		auth.RequireRole(auth.RoleAdmin, p.HandleCheckPort)(w, r)
 	})
 
-	mux.HandleFunc("/api/probes", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/api/probes", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
@@ -117,6 +254,19 @@ func main() {
 	// Reverse proxy
 	mux.Handle("/", p)
 
+	// Prometheus metrics. Services may have a /metrics path of their own,
+	// so their hosts are still proxied.
+	if cfg.Metrics.Enabled {
+		metrics := authMgr.Middleware(p.MetricsHandler())
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			if p.ServesHost(r.Host) {
+				p.ServeHTTP(w, r)
+				return
+			}
+			metrics.ServeHTTP(w, r)
+		})
+	}
+
 	// Health check
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -131,6 +281,7 @@ func main() {
 		ReadTimeout:  60 * time.Second,
 		WriteTimeout: 60 * time.Second,
 	}
+	serverInstance.RegisterOnShutdown(p.CloseEvents)
 	serverMu.Unlock()
 
 	p.SetServer(serverInstance)
@@ -142,6 +293,10 @@ func main() {
 	defer cancel()
 
 	go p.StartIdleReaper(ctx, cfg.IdleReaper.Interval)
+	go p.WatchContainers(ctx)
+	go p.RunNotifiers(ctx)
+	go p.TrackUsage(ctx)
+	go p.RecordHistory(ctx)
 
 	// Start server
 	serverErr := make(chan error, 1)
@@ -181,6 +336,12 @@ func main() {
 		log.Printf("HTTP shutdown error: %v", err)
 	}
 
+	p.FlushUsage()
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("tracing shutdown error: %v", err)
+	}
+
 	if shouldRestart {
 		log.Println("restarting server... (exiting for container restart)")
 		os.Exit(0)
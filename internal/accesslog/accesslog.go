@@ -0,0 +1,215 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"conslee/internal/config"
+)
+
+// Access logs of proxied requests
+
+const (
+	FormatJSON     = "json"
+	FormatCombined = "combined"
+
+	defaultMaxSizeMB  = 100
+	defaultMaxBackups = 5
+)
+
+type Entry struct {
+	Time            time.Time     `json:"time"`
+	Service         string        `json:"service"`
+	Host            string        `json:"host"`
+	Method          string        `json:"method"`
+	Path            string        `json:"path"`
+	Proto           string        `json:"proto"`
+	Status          int           `json:"status"`
+	Bytes           int64         `json:"bytes"`
+	Duration        time.Duration `json:"-"`
+	UpstreamLatency time.Duration `json:"-"`
+	Wake            bool          `json:"wake"`
+	ClientIP        string        `json:"client_ip"`
+	User            string        `json:"user,omitempty"`
+	Referer         string        `json:"referer,omitempty"`
+	UserAgent       string        `json:"user_agent,omitempty"`
+}
+
+// Logger writes one line per request. A nil *Logger discards entries.
+type Logger struct {
+	format string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New returns nil when access logging is disabled.
+func New(cfg config.AccessLogConfig) (*Logger, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	format := cfg.Format
+	if format == "" {
+		format = FormatJSON
+	}
+	if format != FormatJSON && format != FormatCombined {
+		return nil, fmt.Errorf("invalid access_log.format %q", cfg.Format)
+	}
+
+	var w io.Writer = os.Stdout
+	if cfg.Output != "" && cfg.Output != "stdout" {
+		maxSize := cfg.MaxSizeMB
+		if maxSize <= 0 {
+			maxSize = defaultMaxSizeMB
+		}
+		backups := cfg.MaxBackups
+		if backups <= 0 {
+			backups = defaultMaxBackups
+		}
+		rf, err := openRotatingFile(cfg.Output, int64(maxSize)<<20, backups)
+		if err != nil {
+			return nil, err
+		}
+		w = rf
+	}
+	return &Logger{format: format, w: w}, nil
+}
+
+func (l *Logger) Log(e *Entry) {
+	if l == nil {
+		return
+	}
+
+	var line []byte
+	if l.format == FormatCombined {
+		line = combined(e)
+	} else {
+		line = jsonLine(e)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(line)
+}
+
+func jsonLine(e *Entry) []byte {
+	type alias Entry
+	data, _ := json.Marshal(struct {
+		*alias
+		DurationMs        float64 `json:"duration_ms"`
+		UpstreamLatencyMs float64 `json:"upstream_latency_ms"`
+	}{
+		alias:             (*alias)(e),
+		DurationMs:        ms(e.Duration),
+		UpstreamLatencyMs: ms(e.UpstreamLatency),
+	})
+	return append(data, '\n')
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// combined is the Apache/nginx combined format with Conslee's fields
+// appended, so existing parsers still match the start of the line.
+func combined(e *Entry) []byte {
+	var b strings.Builder
+	b.WriteString(dash(e.ClientIP))
+	b.WriteString(" - ")
+	b.WriteString(dash(e.User))
+	b.WriteString(" [")
+	b.WriteString(e.Time.Format("02/Jan/2006:15:04:05 -0700"))
+	b.WriteString(`] "`)
+	b.WriteString(escape(e.Method + " " + e.Path + " " + e.Proto))
+	b.WriteString(`" `)
+	b.WriteString(strconv.Itoa(e.Status))
+	b.WriteByte(' ')
+	if e.Bytes > 0 {
+		b.WriteString(strconv.FormatInt(e.Bytes, 10))
+	} else {
+		b.WriteByte('-')
+	}
+	fmt.Fprintf(&b, ` "%s" "%s"`, escape(dash(e.Referer)), escape(dash(e.UserAgent)))
+	fmt.Fprintf(&b, ` service=%s host=%s wake=%t duration_ms=%.3f upstream_ms=%.3f`+"\n",
+		e.Service, escape(e.Host), e.Wake, ms(e.Duration), ms(e.UpstreamLatency))
+	return []byte(b.String())
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// rotatingFile renames the file to .1, .2, ... once it exceeds maxSize.
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	backups int
+
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open access log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("stat access log: %w", err)
+	}
+	rf.f = f
+	rf.size = info.Size()
+	return nil
+}
+
+// Write is called with the Logger mutex held.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) rotate() error {
+	_ = rf.f.Close()
+	for i := rf.backups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+	}
+	_ = os.Rename(rf.path, rf.path+".1")
+	return rf.open()
+}
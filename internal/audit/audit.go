@@ -0,0 +1,291 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Audit log of management and automatic actions
+
+const (
+	ActionCreate        = "service.create"
+	ActionUpdate        = "service.update"
+	ActionDelete        = "service.delete"
+	ActionStart         = "service.start"
+	ActionStop          = "service.stop"
+	ActionSystemUpdate  = "system.update"
+	ActionIdleStop      = "idle.stop"
+	ActionScheduleStart = "schedule.start"
+	ActionScheduleStop  = "schedule.stop"
+)
+
+// Actors of actions Conslee takes on its own.
+const (
+	ActorIdleReaper = "system:idle-reaper"
+	ActorScheduler  = "system:scheduler"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+const redacted = "[redacted]"
+
+// Change is one field that differs between two configurations. Before or
+// After is nil when the field was added or removed.
+type Change struct {
+	Field  string `json:"field"`
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Action  string    `json:"action"`
+	Service string    `json:"service,omitempty"`
+	Detail  string    `json:"detail,omitempty"`
+	Changes []Change  `json:"changes,omitempty"`
+}
+
+type Filter struct {
+	Service string
+	Actor   string
+	Action  string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+func (f Filter) match(e *Entry) bool {
+	if f.Service != "" && e.Service != f.Service {
+		return false
+	}
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Log is an append-only file of JSON lines. A nil *Log discards entries.
+type Log struct {
+	mu   sync.Mutex
+	path string
+}
+
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	_ = f.Close()
+	return &Log{path: path}, nil
+}
+
+func (l *Log) Append(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Query returns the matching entries, newest first. keep, when set, drops
+// entries the caller may not see before the limit is applied.
+func (l *Log) Query(f Filter, keep func(*Entry) bool) ([]Entry, error) {
+	if l == nil {
+		return nil, nil
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	l.mu.Lock()
+	file, err := os.Open(l.path)
+	l.mu.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var out []Entry
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		if !f.match(&e) || (keep != nil && !keep(&e)) {
+			continue
+		}
+		out = append(out, e)
+		if len(out) > limit {
+			out = out[1:]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// Diff compares two values by their YAML form, so field names match the
+// config file. Secrets such as password hashes are redacted.
+func Diff(before, after any) []Change {
+	b := flatten(toMap(before))
+	a := flatten(toMap(after))
+
+	keys := map[string]struct{}{}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	fields := make([]string, 0, len(keys))
+	for k := range keys {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	var changes []Change
+	for _, k := range fields {
+		bv, bok := b[k]
+		av, aok := a[k]
+		if bok && aok && reflect.DeepEqual(bv, av) {
+			continue
+		}
+		if (!bok && empty(av)) || (!aok && empty(bv)) {
+			continue
+		}
+		ch := Change{Field: k, Before: bv, After: av}
+		if sensitive(k) {
+			if bok {
+				ch.Before = redacted
+			}
+			if aok {
+				ch.After = redacted
+			}
+		}
+		changes = append(changes, ch)
+	}
+	return changes
+}
+
+// Snapshot captures a value for a later Diff, so changes made in place
+// afterwards do not leak into the "before" side.
+func Snapshot(v any) map[string]any {
+	return toMap(v)
+}
+
+func toMap(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// flatten turns nested maps into dotted keys; lists stay whole.
+func flatten(m map[string]any) map[string]any {
+	out := map[string]any{}
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		if sub, ok := v.(map[string]any); ok && len(sub) > 0 {
+			for k, sv := range sub {
+				walk(prefix+"."+k, sv)
+			}
+			return
+		}
+		out[prefix] = v
+	}
+	for k, v := range m {
+		walk(k, v)
+	}
+	return out
+}
+
+func empty(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
+
+func sensitive(field string) bool {
+	field = strings.ToLower(field)
+	for _, s := range []string{"password", "secret", "hash", "users"} {
+		if strings.Contains(field, s) {
+			return true
+		}
+	}
+	return false
+}
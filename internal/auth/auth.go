@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"conslee/internal/config"
+)
+
+// Principal types
+
+const (
+	MethodNone    = "none"
+	MethodSession = "session"
+	MethodToken   = "token"
+	MethodOIDC    = "oidc"
+)
+
+// Principal is the authenticated caller of a management request.
+type Principal struct {
+	Name   string   `json:"name"`
+	Method string   `json:"method"`
+	Role   Role     `json:"role"`
+	Groups []string `json:"groups,omitempty"`
+
+	ServiceLabels map[string]string `json:"serviceLabels,omitempty"`
+}
+
+// anonymous is the caller when authentication is disabled.
+var anonymous = &Principal{Name: "anonymous", Method: MethodNone, Role: RoleAdmin}
+
+type ctxKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the caller stored by the middleware, or nil.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(ctxKey{}).(*Principal)
+	return p
+}
+
+// Authenticator resolves the caller of a request. It returns nil, nil when
+// the request carries no credentials it understands, so the next
+// authenticator can try.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Manager
+
+const defaultSessionTTL = 12 * time.Hour
+
+type Manager struct {
+	mu             sync.RWMutex
+	cfg            config.AuthConfig
+	sessions       *SessionStore
+	oidc           *oidcProvider
+	authenticators []Authenticator
+	allowRedirect  func(*url.URL) bool
+}
+
+func NewManager(cfg config.AuthConfig) *Manager {
+	ttl := cfg.SessionTTL
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	m := &Manager{
+		cfg:      cfg,
+		sessions: NewSessionStore(ttl),
+	}
+	if oc := cfg.OIDC; oc != nil && oc.Enabled {
+		m.oidc = newOIDCProvider(*oc)
+	}
+	m.authenticators = []Authenticator{
+		&sessionAuthenticator{m: m},
+		&tokenAuthenticator{m: m},
+	}
+	return m
+}
+
+// Register adds an authenticator that is tried after the built-in ones.
+func (m *Manager) Register(a Authenticator) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.authenticators = append(m.authenticators, a)
+}
+
+// SetRedirectPolicy decides which URLs a user may be sent back to after
+// signing in, typically the hosts of protected services.
+func (m *Manager) SetRedirectPolicy(allow func(*url.URL) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.allowRedirect = allow
+}
+
+// safeRedirect returns rd if it is a local UI path or allowed by the
+// redirect policy, and the UI otherwise.
+func (m *Manager) safeRedirect(rd string) string {
+	if rd == "" {
+		return "/ui/"
+	}
+	u, err := url.Parse(rd)
+	if err != nil {
+		return "/ui/"
+	}
+	if u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/ui/") {
+		return u.String()
+	}
+	m.mu.RLock()
+	allow := m.allowRedirect
+	m.mu.RUnlock()
+	if (u.Scheme == "http" || u.Scheme == "https") && allow != nil && allow(u) {
+		return u.String()
+	}
+	return "/ui/"
+}
+
+// LoginURL is the sign-in page that returns to rd afterwards, or "" when no
+// public_url is configured.
+func (m *Manager) LoginURL(rd string) string {
+	base := strings.TrimSuffix(m.config().PublicURL, "/")
+	if base == "" {
+		return ""
+	}
+	return base + "/ui/?rd=" + url.QueryEscape(rd)
+}
+
+// SessionPrincipal returns the signed-in UI user of a request, or nil.
+// Unlike Authenticate it ignores API tokens.
+func (m *Manager) SessionPrincipal(r *http.Request) *Principal {
+	if !m.Enabled() {
+		return nil
+	}
+	p, _ := (&sessionAuthenticator{m: m}).Authenticate(r)
+	return p
+}
+
+func (m *Manager) config() config.AuthConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cfg
+}
+
+func (m *Manager) Enabled() bool {
+	return m.config().Enabled
+}
+
+func (m *Manager) Sessions() *SessionStore {
+	return m.sessions
+}
+
+// Authenticate runs the registered authenticators in order.
+func (m *Manager) Authenticate(r *http.Request) (*Principal, error) {
+	if !m.Enabled() {
+		return anonymous, nil
+	}
+
+	m.mu.RLock()
+	chain := append([]Authenticator(nil), m.authenticators...)
+	m.mu.RUnlock()
+
+	for _, a := range chain {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// Middleware rejects unauthenticated requests and state-changing requests
+// sent from other sites or without a valid CSRF token, and stores the caller
+// in the request context.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !safeMethod(r.Method) && !m.sameOrigin(r) {
+			logCrossOrigin(r)
+			http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+		p, err := m.Authenticate(r)
+		if err != nil || p == nil {
+			if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !m.checkCSRF(r, p) {
+			http.Error(w, "missing or invalid csrf token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
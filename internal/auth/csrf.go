@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Cross-site request protection
+
+const (
+	CSRFCookie = "conslee_csrf"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// setCSRFCookie hands the token to the UI. The cookie is readable by scripts
+// on purpose: the UI echoes it in the X-CSRF-Token header, which a page on
+// another site cannot do.
+func (m *Manager) setCSRFCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    token,
+		Path:     "/",
+		Secure:   m.config().CookieSecure || r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func (m *Manager) clearCSRFCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   m.config().CookieSecure || r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// csrfToken returns the token a request must carry: the one of its session,
+// or, while authentication is disabled, the one of its CSRF cookie.
+func (m *Manager) csrfToken(r *http.Request) string {
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		if sess, ok := m.sessions.Get(c.Value); ok {
+			return sess.CSRFToken
+		}
+	}
+	if !m.Enabled() {
+		if c, err := r.Cookie(CSRFCookie); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// ensureCSRFCookie issues a token to browsers using the UI without
+// authentication. Signed-in users get theirs with the session.
+func (m *Manager) ensureCSRFCookie(w http.ResponseWriter, r *http.Request) string {
+	if token := m.csrfToken(r); token != "" {
+		return token
+	}
+	if m.Enabled() {
+		return ""
+	}
+	token, err := randomString()
+	if err != nil {
+		slog.Error("create csrf token", "err", err)
+		return ""
+	}
+	m.setCSRFCookie(w, r, token)
+	return token
+}
+
+// sameOrigin checks the Origin header, or the Referer when there is none,
+// against the host the request was sent to and the public URL. Requests
+// without either header come from non-browser clients and pass.
+func (m *Manager) sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if pub, err := url.Parse(m.config().PublicURL); err == nil && pub.Host != "" {
+		return strings.EqualFold(u.Host, pub.Host) && u.Scheme == pub.Scheme
+	}
+	return false
+}
+
+func logCrossOrigin(r *http.Request) {
+	slog.Warn("rejected cross-origin request", "method", r.Method, "path", r.URL.Path, "origin", r.Header.Get("Origin"), "remote", r.RemoteAddr)
+}
+
+// CheckOrigin rejects state-changing requests sent from other sites.
+func (m *Manager) CheckOrigin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !safeMethod(r.Method) && !m.sameOrigin(r) {
+			logCrossOrigin(r)
+			http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// checkCSRF verifies the token of a state-changing request made with a
+// browser cookie. API tokens are not sent by browsers on their own and
+// need no CSRF token. Neither do requests without cookies while
+// authentication is disabled: they carry no credentials to abuse, and
+// browsers sending them cross-site are stopped by the origin check.
+func (m *Manager) checkCSRF(r *http.Request, p *Principal) bool {
+	if safeMethod(r.Method) || p.Method == MethodToken {
+		return true
+	}
+	if p.Method == MethodNone && !hasCookie(r, SessionCookie) && !hasCookie(r, CSRFCookie) {
+		return true
+	}
+	want := m.csrfToken(r)
+	got := r.Header.Get(CSRFHeader)
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+func hasCookie(r *http.Request, name string) bool {
+	_, err := r.Cookie(name)
+	return err == nil
+}
+
+// IsJSON reports whether the request body is declared as JSON. Browsers can
+// only send other types across sites without a preflight.
+func IsJSON(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == "application/json"
+}
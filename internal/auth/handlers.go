@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// Auth handlers
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type MeResponse struct {
+	Enabled       bool       `json:"enabled"`
+	Authenticated bool       `json:"authenticated"`
+	User          *Principal `json:"user,omitempty"`
+
+	PasswordLogin bool   `json:"passwordLogin"`
+	OIDC          string `json:"oidc,omitempty"` // provider name when SSO is enabled
+
+	// CSRFToken must be sent in the X-CSRF-Token header of state-changing
+	// requests; it is also available in the conslee_csrf cookie.
+	CSRFToken string `json:"csrfToken,omitempty"`
+}
+
+// POST /api/auth/login
+func (m *Manager) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	if !m.Enabled() {
+		http.Error(w, "authentication is disabled", http.StatusNotFound)
+		return
+	}
+
+	if !IsJSON(r) {
+		http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" || !m.CheckPassword(req.Username, req.Password) {
+		slog.Warn("failed login", "user", req.Username, "remote", r.RemoteAddr)
+		http.Error(w, "invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	sess, err := m.sessions.Create(req.Username, nil)
+	if err != nil {
+		slog.Error("create session", "user", req.Username, "err", err)
+		http.Error(w, "cannot create session", http.StatusInternalServerError)
+		return
+	}
+	m.setSessionCookie(w, r, sess)
+
+	w.Header().Set("Content-Type", "application/json")
+	u, _ := m.user(sess.User)
+	p := &Principal{Name: sess.User, Method: MethodSession}
+	_ = json.NewEncoder(w).Encode(MeResponse{
+		Enabled:       true,
+		Authenticated: true,
+		User:          p.applyAccess(u.AccessConfig),
+		CSRFToken:     sess.CSRFToken,
+	})
+}
+
+// POST /api/auth/logout
+func (m *Manager) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		m.sessions.Delete(c.Value)
+	}
+	m.clearSessionCookie(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/auth/continue?rd=
+func (m *Manager) HandleContinue(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, m.safeRedirect(r.URL.Query().Get("rd")), http.StatusFound)
+}
+
+// GET /api/auth/me
+func (m *Manager) HandleMe(w http.ResponseWriter, r *http.Request) {
+	cfg := m.config()
+	resp := MeResponse{
+		Enabled:       cfg.Enabled,
+		PasswordLogin: len(cfg.Users) > 0,
+	}
+	if m.oidc != nil {
+		resp.OIDC = m.oidc.name()
+	}
+	if p, err := m.Authenticate(r); err == nil && p != nil {
+		resp.Authenticated = true
+		resp.User = p
+		resp.CSRFToken = m.ensureCSRFCookie(w, r)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"conslee/internal/config"
+)
+
+// Local users and API tokens
+
+// dummyHash is compared against when the user does not exist, so unknown
+// and known usernames take the same time to reject.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("conslee"), bcrypt.DefaultCost)
+
+// CheckPassword verifies a local user's password.
+func (m *Manager) CheckPassword(username, password string) bool {
+	u, _ := m.user(username)
+	return ComparePassword(u.PasswordHash, password)
+}
+
+// ComparePassword checks a password against a bcrypt hash. An empty hash
+// (unknown user) never matches but takes as long as a real comparison.
+func ComparePassword(hash, password string) bool {
+	h := []byte(hash)
+	if hash == "" {
+		h = dummyHash
+	}
+	err := bcrypt.CompareHashAndPassword(h, []byte(password))
+	return hash != "" && err == nil
+}
+
+func (m *Manager) user(username string) (config.UserConfig, bool) {
+	for _, u := range m.config().Users {
+		if u.Username == username {
+			return u, true
+		}
+	}
+	return config.UserConfig{}, false
+}
+
+func HashPassword(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+// HashToken returns the value stored in tokens[].hash for a token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateToken returns a new random API token.
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "cnsl_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+type sessionAuthenticator struct {
+	m *Manager
+}
+
+func (a *sessionAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	c, err := r.Cookie(SessionCookie)
+	if err != nil || c.Value == "" {
+		return nil, nil
+	}
+	sess, ok := a.m.sessions.Get(c.Value)
+	if !ok {
+		return nil, nil
+	}
+	if sess.Access != nil {
+		p := &Principal{Name: sess.User, Method: MethodOIDC}
+		return p.applyAccess(*sess.Access), nil
+	}
+	u, ok := a.m.user(sess.User)
+	if !ok {
+		// The user was removed from the configuration.
+		a.m.sessions.Delete(c.Value)
+		return nil, nil
+	}
+	p := &Principal{Name: sess.User, Method: MethodSession}
+	return p.applyAccess(u.AccessConfig), nil
+}
+
+type tokenAuthenticator struct {
+	m *Manager
+}
+
+func (a *tokenAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, nil
+	}
+	hash := []byte(HashToken(strings.TrimSpace(token)))
+	for _, t := range a.m.config().Tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(strings.ToLower(t.Hash))) == 1 {
+			p := &Principal{Name: "token:" + t.Name, Method: MethodToken}
+			return p.applyAccess(t.AccessConfig), nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"conslee/internal/config"
+)
+
+// OpenID Connect single sign-on
+
+const (
+	oidcStateCookie  = "conslee_oidc_state"
+	oidcCallbackPath = "/api/auth/oidc/callback"
+	oidcLoginTimeout = 10 * time.Minute
+	oidcMaxPending   = 1000 // logins started but not finished
+
+	// oidcUserPrefix sets SSO users apart from local users and tokens of
+	// the same name.
+	oidcUserPrefix = "oidc:"
+)
+
+var errNoRole = errors.New("no role mapped for user")
+
+type pendingLogin struct {
+	verifier    string
+	nonce       string
+	redirectURL string
+	returnTo    string
+	expires     time.Time
+}
+
+type oidcProvider struct {
+	cfg config.OIDCConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+	pending  map[string]*pendingLogin
+}
+
+func newOIDCProvider(cfg config.OIDCConfig) *oidcProvider {
+	return &oidcProvider{
+		cfg:     cfg,
+		pending: map[string]*pendingLogin{},
+	}
+}
+
+func (o *oidcProvider) name() string {
+	if o.cfg.Name != "" {
+		return o.cfg.Name
+	}
+	return "SSO"
+}
+
+// discover fetches the provider metadata on first use, so Conslee starts even
+// while the identity provider is unreachable.
+func (o *oidcProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider != nil {
+		return o.provider, nil
+	}
+	p, err := oidc.NewProvider(ctx, o.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover %s: %w", o.cfg.Issuer, err)
+	}
+	o.provider = p
+	return p, nil
+}
+
+func (o *oidcProvider) oauth2Config(p *oidc.Provider, redirectURL string) *oauth2.Config {
+	scopes := o.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	return &oauth2.Config{
+		ClientID:     o.cfg.ClientID,
+		ClientSecret: o.cfg.ClientSecret,
+		Endpoint:     p.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	}
+}
+
+func (o *oidcProvider) redirectURL(r *http.Request) string {
+	if o.cfg.RedirectURL != "" {
+		return o.cfg.RedirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + oidcCallbackPath
+}
+
+// addPending remembers a started login. Anyone can start one, so when too
+// many are pending the oldest is dropped.
+func (o *oidcProvider) addPending(state string, pl *pendingLogin) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	oldest := ""
+	for s, old := range o.pending {
+		if now.After(old.expires) {
+			delete(o.pending, s)
+		} else if oldest == "" || old.expires.Before(o.pending[oldest].expires) {
+			oldest = s
+		}
+	}
+	if len(o.pending) >= oidcMaxPending {
+		delete(o.pending, oldest)
+	}
+	o.pending[state] = pl
+}
+
+func (o *oidcProvider) takePending(state string) (*pendingLogin, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	pl, ok := o.pending[state]
+	delete(o.pending, state)
+	if !ok || time.Now().After(pl.expires) {
+		return nil, false
+	}
+	return pl, true
+}
+
+// access maps the groups of a user to a role.
+func (o *oidcProvider) access(groups []string) (*config.AccessConfig, error) {
+	best := ""
+	for role, mapped := range o.cfg.RoleMapping {
+		if roleRank(Role(role)) <= roleRank(Role(best)) {
+			continue
+		}
+		for _, g := range mapped {
+			if slices.Contains(groups, g) {
+				best = role
+				break
+			}
+		}
+	}
+	if best == "" {
+		best = o.cfg.DefaultRole
+	}
+	if best == "" {
+		return nil, errNoRole
+	}
+	return &config.AccessConfig{Role: best, Groups: groups}, nil
+}
+
+// identity reads the user name and groups from the ID token claims, falling
+// back to the userinfo endpoint for providers that omit groups there. The
+// user name is the username claim, by default the stable subject, prefixed
+// with "oidc:".
+func (o *oidcProvider) identity(ctx context.Context, p *oidc.Provider, idToken *oidc.IDToken, tok *oauth2.Token) (string, []string, error) {
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return "", nil, fmt.Errorf("decode claims: %w", err)
+	}
+
+	groupsClaim := o.cfg.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	if _, ok := claims[groupsClaim]; !ok && p.UserInfoEndpoint() != "" {
+		info, err := p.UserInfo(ctx, oauth2.StaticTokenSource(tok))
+		if err == nil {
+			var extra map[string]any
+			if err := info.Claims(&extra); err == nil {
+				for k, v := range extra {
+					if _, ok := claims[k]; !ok {
+						claims[k] = v
+					}
+				}
+			}
+		} else {
+			slog.Warn("oidc userinfo", "err", err)
+		}
+	}
+
+	usernameClaim := o.cfg.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "sub"
+	}
+	username, _ := claims[usernameClaim].(string)
+	if username == "" {
+		return "", nil, fmt.Errorf("token has no %q claim", usernameClaim)
+	}
+
+	var groups []string
+	switch v := claims[groupsClaim].(type) {
+	case []any:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	case string:
+		groups = strings.Fields(strings.ReplaceAll(v, ",", " "))
+	}
+	return oidcUserPrefix + username, groups, nil
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func loginFailed(w http.ResponseWriter, r *http.Request, reason string) {
+	http.Redirect(w, r, "/ui/?sso_error="+url.QueryEscape(reason), http.StatusFound)
+}
+
+// OIDC handlers
+
+// GET /api/auth/oidc/login
+func (m *Manager) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	o := m.oidc
+	if o == nil || !m.Enabled() {
+		http.Error(w, "single sign-on is disabled", http.StatusNotFound)
+		return
+	}
+
+	p, err := o.discover(r.Context())
+	if err != nil {
+		slog.Error("oidc discovery", "err", err)
+		loginFailed(w, r, "unavailable")
+		return
+	}
+
+	state, err := randomString()
+	if err != nil {
+		http.Error(w, "cannot start login", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		http.Error(w, "cannot start login", http.StatusInternalServerError)
+		return
+	}
+	pl := &pendingLogin{
+		verifier:    oauth2.GenerateVerifier(),
+		nonce:       nonce,
+		redirectURL: o.redirectURL(r),
+		returnTo:    r.URL.Query().Get("rd"),
+		expires:     time.Now().Add(oidcLoginTimeout),
+	}
+	o.addPending(state, pl)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc/",
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   m.config().CookieSecure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authURL := o.oauth2Config(p, pl.redirectURL).AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(pl.verifier),
+	)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// GET /api/auth/oidc/callback
+func (m *Manager) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	o := m.oidc
+	if o == nil || !m.Enabled() {
+		http.Error(w, "single sign-on is disabled", http.StatusNotFound)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/auth/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		slog.Warn("oidc provider returned an error", "error", e, "description", q.Get("error_description"))
+		loginFailed(w, r, "denied")
+		return
+	}
+
+	state := q.Get("state")
+	c, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || c.Value != state {
+		loginFailed(w, r, "state")
+		return
+	}
+	pl, ok := o.takePending(state)
+	if !ok {
+		loginFailed(w, r, "state")
+		return
+	}
+
+	ctx := r.Context()
+	p, err := o.discover(ctx)
+	if err != nil {
+		slog.Error("oidc discovery", "err", err)
+		loginFailed(w, r, "unavailable")
+		return
+	}
+
+	tok, err := o.oauth2Config(p, pl.redirectURL).Exchange(ctx, q.Get("code"), oauth2.VerifierOption(pl.verifier))
+	if err != nil {
+		slog.Error("oidc exchange code", "err", err)
+		loginFailed(w, r, "failed")
+		return
+	}
+	rawID, ok := tok.Extra("id_token").(string)
+	if !ok {
+		slog.Error("oidc token response has no id_token")
+		loginFailed(w, r, "failed")
+		return
+	}
+	idToken, err := p.Verifier(&oidc.Config{ClientID: o.cfg.ClientID}).Verify(ctx, rawID)
+	if err != nil {
+		slog.Warn("oidc verify id_token", "err", err)
+		loginFailed(w, r, "failed")
+		return
+	}
+	if idToken.Nonce != pl.nonce {
+		slog.Warn("oidc nonce mismatch")
+		loginFailed(w, r, "failed")
+		return
+	}
+
+	username, groups, err := o.identity(ctx, p, idToken, tok)
+	if err != nil {
+		slog.Error("oidc identity", "err", err)
+		loginFailed(w, r, "failed")
+		return
+	}
+	access, err := o.access(groups)
+	if err != nil {
+		slog.Warn("oidc login rejected", "user", username, "groups", groups, "err", err)
+		loginFailed(w, r, "denied")
+		return
+	}
+
+	sess, err := m.sessions.Create(username, access)
+	if err != nil {
+		slog.Error("create session", "user", username, "err", err)
+		loginFailed(w, r, "failed")
+		return
+	}
+	m.setSessionCookie(w, r, sess)
+	slog.Info("oidc sign-in", "user", username, "role", access.Role)
+
+	http.Redirect(w, r, m.safeRedirect(pl.returnTo), http.StatusFound)
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"conslee/internal/config"
+)
+
+// fakeIssuer is a minimal OpenID provider that signs ID tokens with claims
+// set by the test.
+type fakeIssuer struct {
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeIssuer{key: key, claims: map[string]any{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                f.srv.URL,
+			"authorization_endpoint":                f.srv.URL + "/authorize",
+			"token_endpoint":                        f.srv.URL + "/token",
+			"jwks_uri":                              f.srv.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code-1" || r.FormValue("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     f.sign(t),
+		})
+	})
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeIssuer) sign(t *testing.T) string {
+	now := time.Now()
+	claims := map[string]any{
+		"iss": f.srv.URL,
+		"aud": "conslee",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range f.claims {
+		claims[k] = v
+	}
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"}) + "." + enc(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// oidcLogin runs the login and callback handlers and returns the session
+// created, or nil when sign-in failed.
+func oidcLogin(t *testing.T, m *Manager, f *fakeIssuer) *Session {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.HandleOIDCLogin(rec, httptest.NewRequest(http.MethodGet, "http://conslee.test/api/auth/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: status %d", rec.Code)
+	}
+	authURL, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := authURL.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("login without PKCE: %s", authURL)
+	}
+	f.claims["nonce"] = q.Get("nonce")
+
+	req := httptest.NewRequest(http.MethodGet, "http://conslee.test"+oidcCallbackPath+"?code=code-1&state="+url.QueryEscape(q.Get("state")), nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	m.HandleOIDCCallback(rec, req)
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == SessionCookie {
+			sess, _ := m.Sessions().Get(c.Value)
+			return sess
+		}
+	}
+	return nil
+}
+
+func TestOIDCLogin(t *testing.T) {
+	f := newFakeIssuer(t)
+	m := NewManager(config.AuthConfig{
+		Enabled: true,
+		OIDC: &config.OIDCConfig{
+			Enabled:     true,
+			Issuer:      f.srv.URL,
+			ClientID:    "conslee",
+			RoleMapping: map[string][]string{"operator": {"devs"}},
+		},
+	})
+
+	// The editable claims must not decide the user name.
+	f.claims["sub"] = "8f14e45f"
+	f.claims["preferred_username"] = "admin"
+	f.claims["email"] = "admin@example.com"
+	f.claims["groups"] = []string{"devs"}
+	sess := oidcLogin(t, m, f)
+	if sess == nil {
+		t.Fatal("no session created")
+	}
+	if sess.User != "oidc:8f14e45f" {
+		t.Errorf("user = %q, want %q", sess.User, "oidc:8f14e45f")
+	}
+	if sess.Access == nil || sess.Access.Role != "operator" {
+		t.Errorf("access = %+v, want role operator", sess.Access)
+	}
+
+	// Without a mapped group and default role the login is rejected.
+	f.claims["groups"] = []string{"others"}
+	if sess := oidcLogin(t, m, f); sess != nil {
+		t.Errorf("unmapped user signed in as %q", sess.User)
+	}
+}
+
+func TestOIDCPendingBounded(t *testing.T) {
+	o := newOIDCProvider(config.OIDCConfig{})
+	expires := time.Now().Add(oidcLoginTimeout)
+	for i := range oidcMaxPending + 10 {
+		o.addPending(strconv.Itoa(i), &pendingLogin{expires: expires.Add(time.Duration(i))})
+	}
+	if n := len(o.pending); n != oidcMaxPending {
+		t.Fatalf("pending = %d, want %d", n, oidcMaxPending)
+	}
+	if _, ok := o.takePending("0"); ok {
+		t.Error("oldest login was kept")
+	}
+	if _, ok := o.takePending(strconv.Itoa(oidcMaxPending + 9)); !ok {
+		t.Error("newest login was dropped")
+	}
+}
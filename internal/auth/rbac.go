@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+
+	"conslee/internal/config"
+)
+
+// Roles
+
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+func roleRank(r Role) int {
+	switch r {
+	case RoleAdmin:
+		return 3
+	case RoleOperator:
+		return 2
+	case RoleViewer:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ParseRole maps a configured role to a Role. An empty role means admin, so
+// configurations written before roles existed keep full access.
+func ParseRole(s string) Role {
+	if s == "" {
+		return RoleAdmin
+	}
+	return Role(s)
+}
+
+func (p *Principal) applyAccess(ac config.AccessConfig) *Principal {
+	p.Role = ParseRole(ac.Role)
+	p.Groups = ac.Groups
+	p.ServiceLabels = ac.ServiceLabels
+	return p
+}
+
+// HasRole reports whether the caller has at least the given role.
+func (p *Principal) HasRole(r Role) bool {
+	return p != nil && roleRank(p.Role) >= roleRank(r)
+}
+
+// Owns reports whether a service is in the caller's scope: the caller or one
+// of its groups is listed in owners, or the service carries all of the
+// caller's service_labels. Admins own everything.
+func (p *Principal) Owns(sc config.ServiceConfig) bool {
+	if p == nil {
+		return false
+	}
+	if p.HasRole(RoleAdmin) {
+		return true
+	}
+	for _, o := range sc.Owners {
+		if o == p.Name || slices.Contains(p.Groups, o) {
+			return true
+		}
+	}
+	if len(p.ServiceLabels) == 0 {
+		return false
+	}
+	for k, v := range p.ServiceLabels {
+		if sc.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Service permissions
+
+// CanView: services without owners and labels are shared and visible to
+// every role; owned services only to their owners.
+func (p *Principal) CanView(sc config.ServiceConfig) bool {
+	if !p.HasRole(RoleViewer) {
+		return false
+	}
+	if len(sc.Owners) == 0 && len(sc.Labels) == 0 {
+		return true
+	}
+	return p.Owns(sc)
+}
+
+// CanOperate covers starting, stopping and editing a service.
+func (p *Principal) CanOperate(sc config.ServiceConfig) bool {
+	return p.HasRole(RoleOperator) && p.Owns(sc)
+}
+
+// CanDelete: removing services, like creating them, is reserved to admins.
+func (p *Principal) CanDelete(sc config.ServiceConfig) bool {
+	return p.HasRole(RoleAdmin)
+}
+
+// RequireRole wraps a handler that needs at least the given role. It must be
+// used behind Middleware.
+func RequireRole(role Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !FromContext(r.Context()).HasRole(role) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
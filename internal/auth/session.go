@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+
+	"conslee/internal/config"
+)
+
+// Session store
+
+const SessionCookie = "conslee_session"
+
+type Session struct {
+	ID      string
+	User    string
+	Expires time.Time
+
+	// CSRFToken must accompany state-changing API requests of the session.
+	CSRFToken string
+
+	// Access is set for single sign-on users, whose role and groups come
+	// from the identity provider. Local users are looked up on every request.
+	Access *config.AccessConfig
+}
+
+// SessionStore keeps UI sessions in memory; they do not survive a restart.
+type SessionStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*Session
+}
+
+func NewSessionStore(ttl time.Duration) *SessionStore {
+	return &SessionStore{
+		ttl:      ttl,
+		sessions: map[string]*Session{},
+	}
+}
+
+func (s *SessionStore) Create(user string, access *config.AccessConfig) (*Session, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	csrf := make([]byte, 24)
+	if _, err := rand.Read(csrf); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sess := &Session{
+		ID:        base64.RawURLEncoding.EncodeToString(buf),
+		User:      user,
+		Expires:   now.Add(s.ttl),
+		Access:    access,
+		CSRFToken: base64.RawURLEncoding.EncodeToString(csrf),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, old := range s.sessions {
+		if now.After(old.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[sess.ID] = sess
+	return sess, nil
+}
+
+func (s *SessionStore) Get(id string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(sess.Expires) {
+		delete(s.sessions, id)
+		return nil, false
+	}
+	return sess, true
+}
+
+func (s *SessionStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// DeleteUser drops every session of a user, e.g. after it was removed.
+func (s *SessionStore) DeleteUser(user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sess := range s.sessions {
+		if sess.User == user {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+func (m *Manager) setSessionCookie(w http.ResponseWriter, r *http.Request, sess *Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    sess.ID,
+		Path:     "/",
+		Domain:   m.config().CookieDomain,
+		Expires:  sess.Expires,
+		HttpOnly: true,
+		Secure:   m.config().CookieSecure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	m.setCSRFCookie(w, r, sess.CSRFToken)
+}
+
+func (m *Manager) clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		Domain:   m.config().CookieDomain,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   m.config().CookieSecure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	m.clearCSRFCookie(w, r)
+}
@@ -4,18 +4,28 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"conslee/internal/events"
 )
 
 // Config types
 
 type ServerConfig struct {
 	ListenAddr string `yaml:"listen_addr"`
+
+	// TrustedProxies lists the addresses (IPs or CIDRs) whose X-Forwarded-*
+	// and X-Real-IP headers are honored. Headers from other peers are dropped.
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
 }
 
 type IdleReaperConfig struct {
@@ -29,6 +39,102 @@ type ScheduleConfig struct {
 	Stop  string   `yaml:"stop"`  // "23:00"
 }
 
+type TransportConfig struct {
+	MaxIdleConns        int           `yaml:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host,omitempty"`
+	MaxConnsPerHost     int           `yaml:"max_conns_per_host,omitempty"`
+	RawIdleConnTimeout  string        `yaml:"idle_conn_timeout,omitempty"`
+	IdleConnTimeout     time.Duration `yaml:"-"`
+	HTTP2               bool          `yaml:"http2,omitempty"` // HTTP/2 over TLS
+	H2C                 bool          `yaml:"h2c,omitempty"`   // HTTP/2 without TLS (prior knowledge)
+}
+
+// UpstreamTLSConfig controls how Conslee verifies HTTPS upstreams. Without
+// verify or ca_file the certificate is not checked, as in earlier versions,
+// and a warning is logged whenever such a service is loaded, created or
+// given new targets.
+type UpstreamTLSConfig struct {
+	Verify     *bool  `yaml:"verify,omitempty"`
+	CAFile     string `yaml:"ca_file,omitempty"`
+	ServerName string `yaml:"server_name,omitempty"`
+	CertFile   string `yaml:"cert_file,omitempty"`
+	KeyFile    string `yaml:"key_file,omitempty"`
+}
+
+// BufferConfig enables accepting requests while a service is starting and
+// replaying them once it is ready.
+type BufferConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Status      int           `yaml:"status,omitempty"`        // response status, default 202
+	Methods     []string      `yaml:"methods,omitempty"`       // default POST, PUT, PATCH, DELETE
+	MaxBodySize int64         `yaml:"max_body_size,omitempty"` // bytes, default 10 MiB
+	MemoryLimit int64         `yaml:"memory_limit,omitempty"`  // larger bodies are spooled to disk, default 1 MiB
+	MaxPending  int           `yaml:"max_pending,omitempty"`   // default 100
+	RawMaxAge   string        `yaml:"max_age,omitempty"`       // default 10m
+	MaxAge      time.Duration `yaml:"-"`
+	SpoolDir    string        `yaml:"spool_dir,omitempty"`
+}
+
+// ServiceAuthConfig protects a proxied service. Requests are checked before
+// the service is woken up.
+type ServiceAuthConfig struct {
+	Type  string `yaml:"type"` // "basic" | "sso" | "forward_auth"
+	Realm string `yaml:"realm,omitempty"`
+
+	// basic
+	Users []UserConfig `yaml:"users,omitempty"`
+
+	// sso: minimum role of the signed-in Conslee user, default "viewer"
+	Role string `yaml:"role,omitempty"`
+
+	// forward_auth
+	ForwardAuth *ForwardAuthConfig `yaml:"forward_auth,omitempty"`
+}
+
+type ForwardAuthConfig struct {
+	URL             string        `yaml:"url"`
+	ResponseHeaders []string      `yaml:"response_headers,omitempty"` // default: Remote-User, Remote-Groups, Remote-Name, Remote-Email
+	RawTimeout      string        `yaml:"timeout,omitempty"`          // default 5s
+	Timeout         time.Duration `yaml:"-"`
+}
+
+// WakeConfig limits which requests may start a stopped service. Requests
+// that do not qualify are proxied if the service is already running and
+// answered with Response otherwise.
+type WakeConfig struct {
+	// Paths are exact paths or prefixes ending in "*"; empty means all.
+	Paths       []string `yaml:"paths,omitempty"`
+	IgnorePaths []string `yaml:"ignore_paths,omitempty"`
+	Methods     []string `yaml:"methods,omitempty"`
+	// User agents are matched as case-insensitive substrings.
+	UserAgents       []string `yaml:"user_agents,omitempty"`
+	IgnoreUserAgents []string `yaml:"ignore_user_agents,omitempty"`
+	CIDRs            []string `yaml:"cidrs,omitempty"`
+
+	Response *WakeResponseConfig `yaml:"response,omitempty"`
+}
+
+type WakeResponseConfig struct {
+	Status      int    `yaml:"status,omitempty"` // default 503
+	ContentType string `yaml:"content_type,omitempty"`
+	Body        string `yaml:"body,omitempty"`
+}
+
+// RateLimitConfig throttles requests to a service. Zero values disable the
+// corresponding limit.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second,omitempty"`
+	Burst             int     `yaml:"burst,omitempty"` // default: requests_per_second, at least 1
+
+	PerClientRequestsPerSecond float64 `yaml:"per_client_requests_per_second,omitempty"`
+	PerClientBurst             int     `yaml:"per_client_burst,omitempty"`
+
+	MaxConcurrent   int           `yaml:"max_concurrent,omitempty"`
+	MaxQueue        int           `yaml:"max_queue,omitempty"`     // requests waiting for a slot, default 0
+	RawQueueTimeout string        `yaml:"queue_timeout,omitempty"` // default 10s
+	QueueTimeout    time.Duration `yaml:"-"`
+}
+
 type ServiceConfig struct {
 	Name string `yaml:"name"`
 	Host string `yaml:"host"`
@@ -38,11 +144,43 @@ type ServiceConfig struct {
 
 	TargetURL string `yaml:"target_url"`
 
+	// Replicas: target_urls are additional upstreams balanced together with
+	// target_url; replica_containers maps each upstream (in the same order)
+	// to the container serving it.
+	TargetURLs        []string      `yaml:"target_urls,omitempty"`
+	ReplicaContainers []string      `yaml:"replica_containers,omitempty"`
+	LoadBalancer      string        `yaml:"load_balancer,omitempty"` // "round_robin" | "least_conn"
+	MinReplicas       int           `yaml:"min_replicas,omitempty"`
+	ScaleUpThreshold  int           `yaml:"scale_up_threshold,omitempty"` // in-flight requests per replica
+	MaxFails          int           `yaml:"max_fails,omitempty"`
+	RawFailTimeout    string        `yaml:"fail_timeout,omitempty"`
+	FailTimeout       time.Duration `yaml:"-"`
+
+	Transport *TransportConfig   `yaml:"transport,omitempty"`
+	TLS       *UpstreamTLSConfig `yaml:"tls,omitempty"`
+	Buffer    *BufferConfig      `yaml:"buffer,omitempty"`
+	Auth      *ServiceAuthConfig `yaml:"auth,omitempty"`
+	Wake      *WakeConfig        `yaml:"wake,omitempty"`
+	RateLimit *RateLimitConfig   `yaml:"rate_limit,omitempty"`
+
 	Mode     string          `yaml:"mode"` // "on_demand" | "schedule_only" | "both"
 	Schedule *ScheduleConfig `yaml:"schedule"`
 
 	Disabled bool `yaml:"disabled,omitempty"`
 
+	// Access control: owners are user names or groups allowed to manage the
+	// service; labels are matched against a user's service_labels.
+	Owners []string          `yaml:"owners,omitempty"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// NotifyEmail are additional recipients of email notifications about
+	// this service.
+	NotifyEmail []string `yaml:"notify_email,omitempty"`
+
+	// Client IP filtering (IPs or CIDRs); deny wins over allow.
+	AllowCIDRs []string `yaml:"allow_cidrs,omitempty"`
+	DenyCIDRs  []string `yaml:"deny_cidrs,omitempty"`
+
 	RawIdleTimeout    string        `yaml:"idle_timeout"`
 	IdleTimeout       time.Duration `yaml:"-"`
 	RawStartupTimeout string        `yaml:"startup_timeout"`
@@ -50,9 +188,243 @@ type ServiceConfig struct {
 	HealthPath        string        `yaml:"health_path"`
 }
 
+// AuthConfig protects the management API and UI.
+type AuthConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Users         []UserConfig  `yaml:"users,omitempty"`
+	Tokens        []TokenConfig `yaml:"tokens,omitempty"`
+	RawSessionTTL string        `yaml:"session_ttl,omitempty"` // default 12h
+	SessionTTL    time.Duration `yaml:"-"`
+	CookieSecure  bool          `yaml:"cookie_secure,omitempty"`
+	CookieDomain  string        `yaml:"cookie_domain,omitempty"` // share sessions with services for sso
+	PublicURL     string        `yaml:"public_url,omitempty"`    // where services redirect to sign in
+	OIDC          *OIDCConfig   `yaml:"oidc,omitempty"`
+}
+
+// OIDCConfig enables single sign-on with an OpenID Connect provider.
+type OIDCConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Name         string   `yaml:"name,omitempty"` // shown on the login button
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret,omitempty"` // empty for public clients
+	RedirectURL  string   `yaml:"redirect_url,omitempty"`  // default: derived from the request
+	Scopes       []string `yaml:"scopes,omitempty"`        // default: openid, profile, email
+
+	UsernameClaim string `yaml:"username_claim,omitempty"` // default "sub"; must be unique and not user-editable
+	GroupsClaim   string `yaml:"groups_claim,omitempty"`   // default "groups"
+
+	// RoleMapping maps a role to the groups granting it; the highest role
+	// wins. Users without a mapped group get DefaultRole, or are rejected
+	// when it is empty.
+	RoleMapping map[string][]string `yaml:"role_mapping,omitempty"`
+	DefaultRole string              `yaml:"default_role,omitempty"`
+}
+
+// AccessConfig is the role and service scope of a user or token.
+type AccessConfig struct {
+	Role          string            `yaml:"role,omitempty"` // "viewer" | "operator" | "admin" (default)
+	Groups        []string          `yaml:"groups,omitempty"`
+	ServiceLabels map[string]string `yaml:"service_labels,omitempty"`
+}
+
+// ValidLogLevel accepts the log levels of LogConfig; empty means the default.
+func ValidLogLevel(level string) bool {
+	switch level {
+	case "", "debug", "info", "warn", "error":
+		return true
+	}
+	return false
+}
+
+func ValidLogFormat(format string) bool {
+	return format == "" || format == "text" || format == "json"
+}
+
+// EventTypes are the lifecycle events webhooks and emails can subscribe to.
+var EventTypes = []string{
+	events.TypeWaking, events.TypeReady, events.TypeFailed, events.TypeIdleStopped,
+	events.TypeScheduleStopped, events.TypeConfigChanged, events.TypeContainer,
+}
+
+func parseWebhook(w *WebhookConfig) error {
+	if w.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url")
+	}
+	for _, e := range w.Events {
+		if e != "*" && !slices.Contains(EventTypes, e) {
+			return fmt.Errorf("unknown event %q", e)
+		}
+	}
+	if w.MaxRetries != nil && *w.MaxRetries < 0 {
+		return fmt.Errorf("max_retries must not be negative")
+	}
+	if w.RawTimeout != "" {
+		d, err := time.ParseDuration(w.RawTimeout)
+		if err != nil {
+			return fmt.Errorf("parse timeout: %w", err)
+		}
+		w.Timeout = d
+	}
+	return nil
+}
+
+func parseEmail(e *EmailConfig) error {
+	if e.Host == "" || e.From == "" {
+		return fmt.Errorf("host and from are required")
+	}
+	for _, a := range append([]string{e.From}, e.To...) {
+		if _, err := mail.ParseAddress(a); err != nil {
+			return fmt.Errorf("invalid address %q", a)
+		}
+	}
+	switch e.TLS {
+	case "", "starttls", "tls", "none":
+	default:
+		return fmt.Errorf("invalid tls mode %q", e.TLS)
+	}
+	for _, ev := range e.Events {
+		if !slices.Contains(EventTypes, ev) {
+			return fmt.Errorf("unknown event %q", ev)
+		}
+	}
+	if e.FailureThreshold < 0 {
+		return fmt.Errorf("failure_threshold must not be negative")
+	}
+	if e.RawDigestInterval == "" {
+		e.RawDigestInterval = "5m"
+	}
+	d, err := time.ParseDuration(e.RawDigestInterval)
+	if err != nil {
+		return fmt.Errorf("parse digest_interval: %w", err)
+	}
+	e.DigestInterval = d
+	return nil
+}
+
+func validRole(role string) bool {
+	switch role {
+	case "", "viewer", "operator", "admin":
+		return true
+	}
+	return false
+}
+
+type UserConfig struct {
+	Username     string `yaml:"username"`
+	PasswordHash string `yaml:"password_hash"` // bcrypt
+	AccessConfig `yaml:",inline"`
+}
+
+type TokenConfig struct {
+	Name         string `yaml:"name"`
+	Hash         string `yaml:"hash"` // hex-encoded SHA-256 of the token
+	AccessConfig `yaml:",inline"`
+}
+
+// MetricsConfig exposes Prometheus metrics on /metrics. When authentication
+// is enabled, scrapers need an API token.
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// LogConfig controls Conslee's own log output. Both settings can be changed
+// at runtime through the system API.
+type LogConfig struct {
+	Level  string `yaml:"level,omitempty"`  // "debug" | "info" (default) | "warn" | "error"
+	Format string `yaml:"format,omitempty"` // "text" (default) | "json"
+}
+
+// WebhookConfig posts service lifecycle events to a URL.
+type WebhookConfig struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+
+	// Events to send, or "*" for all; default: failed, idle-stopped and
+	// schedule-stopped. Services limits them to some services.
+	Events   []string `yaml:"events,omitempty"`
+	Services []string `yaml:"services,omitempty"`
+
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Template renders the JSON body with text/template; default: the event.
+	Template string `yaml:"template,omitempty"`
+	// Secret signs the body with HMAC-SHA256 (X-Conslee-Signature header).
+	Secret string `yaml:"secret,omitempty"`
+
+	MaxRetries *int          `yaml:"max_retries,omitempty"` // default 5
+	RawTimeout string        `yaml:"timeout,omitempty"`     // per attempt, default 10s
+	Timeout    time.Duration `yaml:"-"`
+}
+
+// EmailConfig sends notifications over SMTP: when wakes of a service keep
+// failing, when it is stuck starting, and optionally on other events.
+type EmailConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port,omitempty"` // default 587, or 465 with tls: tls
+	TLS      string `yaml:"tls,omitempty"`  // "starttls" (default) | "tls" | "none"
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	From     string `yaml:"from"`
+
+	// To receives the notifications of all services; services can add
+	// recipients with notify_email.
+	To []string `yaml:"to,omitempty"`
+
+	// Events are lifecycle events sent as they happen, in addition to the
+	// failure and startup alerts; default none.
+	Events []string `yaml:"events,omitempty"`
+
+	// FailureThreshold is the number of failed wakes in a row that
+	// triggers an alert, default 3.
+	FailureThreshold int `yaml:"failure_threshold,omitempty"`
+
+	// Notifications are batched into one email per recipient and interval,
+	// default 5m; 0s sends each one right away.
+	RawDigestInterval string        `yaml:"digest_interval,omitempty"`
+	DigestInterval    time.Duration `yaml:"-"`
+}
+
+// AccessLogConfig logs every proxied request.
+type AccessLogConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Format     string `yaml:"format,omitempty"`      // "json" (default) | "combined"
+	Output     string `yaml:"output,omitempty"`      // "stdout" (default) or a file path
+	MaxSizeMB  int    `yaml:"max_size_mb,omitempty"` // rotate files at this size, default 100
+	MaxBackups int    `yaml:"max_backups,omitempty"` // rotated files kept, default 5
+}
+
+// TracingConfig exports OpenTelemetry traces over OTLP/HTTP.
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Endpoint is the collector URL, e.g. "http://otel-collector:4318"; the
+	// path defaults to /v1/traces. Empty: the OTEL_EXPORTER_OTLP_* variables,
+	// or http://localhost:4318.
+	Endpoint    string            `yaml:"endpoint,omitempty"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	ServiceName string            `yaml:"service_name,omitempty"` // default "conslee"
+	SampleRatio *float64          `yaml:"sample_ratio,omitempty"` // 0..1, default 1
+}
+
 type Config struct {
+	// DataDir holds state files such as the audit log; default: the
+	// directory of the config file.
+	DataDir string `yaml:"data_dir,omitempty"`
+
 	Server     ServerConfig     `yaml:"server"`
 	IdleReaper IdleReaperConfig `yaml:"idle_reaper"`
+	Log        LogConfig        `yaml:"log,omitempty"`
+	Metrics    MetricsConfig    `yaml:"metrics,omitempty"`
+	Tracing    TracingConfig    `yaml:"tracing,omitempty"`
+	AccessLog  AccessLogConfig  `yaml:"access_log,omitempty"`
+	Webhooks   []WebhookConfig  `yaml:"webhooks,omitempty"`
+	Email      EmailConfig      `yaml:"email,omitempty"`
+	Auth       AuthConfig       `yaml:"auth"`
 	Services   []ServiceConfig  `yaml:"services"`
 }
 
@@ -97,6 +469,10 @@ func Load(path string) (*Config, error) {
 		cfg.Server.ListenAddr = ":8800"
 	}
 
+	if _, err := ParsePrefixes(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("parse server.trusted_proxies: %w", err)
+	}
+
 	if cfg.IdleReaper.RawInterval == "" {
 		cfg.IdleReaper.RawInterval = "1m"
 	}
@@ -106,6 +482,60 @@ func Load(path string) (*Config, error) {
 	}
 	cfg.IdleReaper.Interval = interval
 
+	if !ValidLogLevel(cfg.Log.Level) {
+		return nil, fmt.Errorf("log.level: invalid level %q", cfg.Log.Level)
+	}
+	if !ValidLogFormat(cfg.Log.Format) {
+		return nil, fmt.Errorf("log.format: invalid format %q", cfg.Log.Format)
+	}
+
+	if r := cfg.Tracing.SampleRatio; r != nil && (*r < 0 || *r > 1) {
+		return nil, fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+
+	for i := range cfg.Webhooks {
+		if err := parseWebhook(&cfg.Webhooks[i]); err != nil {
+			return nil, fmt.Errorf("webhook %s: %w", cfg.Webhooks[i].Name, err)
+		}
+	}
+
+	if cfg.Email.Enabled {
+		if err := parseEmail(&cfg.Email); err != nil {
+			return nil, fmt.Errorf("email: %w", err)
+		}
+	}
+
+	if cfg.Auth.RawSessionTTL != "" {
+		ttl, err := time.ParseDuration(cfg.Auth.RawSessionTTL)
+		if err != nil {
+			return nil, fmt.Errorf("parse auth.session_ttl: %w", err)
+		}
+		cfg.Auth.SessionTTL = ttl
+	}
+	for _, u := range cfg.Auth.Users {
+		if !validRole(u.Role) {
+			return nil, fmt.Errorf("auth user %s: invalid role %q", u.Username, u.Role)
+		}
+	}
+	for _, t := range cfg.Auth.Tokens {
+		if !validRole(t.Role) {
+			return nil, fmt.Errorf("auth token %s: invalid role %q", t.Name, t.Role)
+		}
+	}
+	if oc := cfg.Auth.OIDC; oc != nil && oc.Enabled {
+		if oc.Issuer == "" || oc.ClientID == "" {
+			return nil, fmt.Errorf("auth.oidc: issuer and client_id are required")
+		}
+		for role := range oc.RoleMapping {
+			if role == "" || !validRole(role) {
+				return nil, fmt.Errorf("auth.oidc.role_mapping: invalid role %q", role)
+			}
+		}
+		if !validRole(oc.DefaultRole) {
+			return nil, fmt.Errorf("auth.oidc.default_role: invalid role %q", oc.DefaultRole)
+		}
+	}
+
 	for i := range cfg.Services {
 		s := &cfg.Services[i]
 
@@ -136,11 +566,106 @@ func Load(path string) (*Config, error) {
 			return nil, fmt.Errorf("parse services[%d].startup_timeout: %w", i, err)
 		}
 		s.StartupTimeout = sd
+
+		// fail_timeout
+		if s.RawFailTimeout != "" {
+			fd, err := time.ParseDuration(s.RawFailTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("parse services[%d].fail_timeout: %w", i, err)
+			}
+			s.FailTimeout = fd
+		}
+
+		// transport.idle_conn_timeout
+		if s.Transport != nil && s.Transport.RawIdleConnTimeout != "" {
+			td, err := time.ParseDuration(s.Transport.RawIdleConnTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("parse services[%d].transport.idle_conn_timeout: %w", i, err)
+			}
+			s.Transport.IdleConnTimeout = td
+		}
+
+		// buffer.max_age
+		if s.Buffer != nil && s.Buffer.RawMaxAge != "" {
+			bd, err := time.ParseDuration(s.Buffer.RawMaxAge)
+			if err != nil {
+				return nil, fmt.Errorf("parse services[%d].buffer.max_age: %w", i, err)
+			}
+			s.Buffer.MaxAge = bd
+		}
+
+		if _, err := ParsePrefixes(s.AllowCIDRs); err != nil {
+			return nil, fmt.Errorf("parse services[%d].allow_cidrs: %w", i, err)
+		}
+		if _, err := ParsePrefixes(s.DenyCIDRs); err != nil {
+			return nil, fmt.Errorf("parse services[%d].deny_cidrs: %w", i, err)
+		}
+
+		// rate_limit.queue_timeout
+		if s.RateLimit != nil && s.RateLimit.RawQueueTimeout != "" {
+			qd, err := time.ParseDuration(s.RateLimit.RawQueueTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("parse services[%d].rate_limit.queue_timeout: %w", i, err)
+			}
+			s.RateLimit.QueueTimeout = qd
+		}
+
+		if s.Wake != nil {
+			if _, err := ParsePrefixes(s.Wake.CIDRs); err != nil {
+				return nil, fmt.Errorf("parse services[%d].wake.cidrs: %w", i, err)
+			}
+		}
+
+		// auth
+		if a := s.Auth; a != nil {
+			switch a.Type {
+			case "basic", "sso":
+			case "forward_auth":
+				if a.ForwardAuth == nil || a.ForwardAuth.URL == "" {
+					return nil, fmt.Errorf("services[%d].auth: forward_auth.url is required", i)
+				}
+				if a.ForwardAuth.RawTimeout != "" {
+					ad, err := time.ParseDuration(a.ForwardAuth.RawTimeout)
+					if err != nil {
+						return nil, fmt.Errorf("parse services[%d].auth.forward_auth.timeout: %w", i, err)
+					}
+					a.ForwardAuth.Timeout = ad
+				}
+			default:
+				return nil, fmt.Errorf("services[%d].auth: invalid type %q", i, a.Type)
+			}
+			if !validRole(a.Role) {
+				return nil, fmt.Errorf("services[%d].auth: invalid role %q", i, a.Role)
+			}
+		}
 	}
 
 	return &cfg, nil
 }
 
+// ParsePrefixes parses a list of CIDRs; plain IPs are taken as single-address
+// prefixes.
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if strings.Contains(s, "/") {
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return out, nil
+}
+
 func defaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
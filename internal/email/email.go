@@ -0,0 +1,419 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"conslee/internal/audit"
+	"conslee/internal/config"
+	"conslee/internal/events"
+)
+
+// Email notifications over SMTP
+
+const (
+	defaultFailureThreshold = 3
+	defaultStartupTimeout   = 30 * time.Second
+	// stuckGrace is added to a service's startup timeout before it counts
+	// as stuck, so that a wake failing right at the timeout is reported as
+	// a failure instead.
+	stuckGrace    = 10 * time.Second
+	checkInterval = 5 * time.Second
+	dialTimeout   = 30 * time.Second
+	// sendTimeout bounds the whole SMTP conversation of one email.
+	sendTimeout  = time.Minute
+	firstBackoff = time.Second
+	maxBackoff   = 5 * time.Minute
+	// maxPending bounds the notifications kept for a recipient while the
+	// SMTP server cannot be reached.
+	maxPending = 200
+)
+
+// ServiceInfo is what the notifier needs to know about a service.
+type ServiceInfo struct {
+	Recipients     []string
+	StartupTimeout time.Duration
+}
+
+// Lookup returns the current settings of a service; ok is false once it has
+// been deleted.
+type Lookup func(service string) (info ServiceInfo, ok bool)
+
+type notification struct {
+	time    time.Time
+	subject string
+	text    string
+}
+
+// Notifier turns lifecycle events into email notifications. A nil
+// *Notifier sends nothing.
+type Notifier struct {
+	cfg    config.EmailConfig
+	lookup Lookup
+	send   func(to []string, msg []byte) error
+
+	mu       sync.Mutex
+	failures map[string]int       // failed wakes in a row
+	waking   map[string]time.Time // services being started, since
+	stuck    map[string]bool      // already reported as stuck
+	pending  map[string][]notification
+
+	// ready asks Run to send what is pending when there is no digest.
+	ready chan struct{}
+}
+
+// New returns nil when email notifications are disabled.
+func New(cfg config.EmailConfig, lookup Lookup) *Notifier {
+	if !cfg.Enabled {
+		return nil
+	}
+	n := &Notifier{
+		cfg:      cfg,
+		lookup:   lookup,
+		failures: map[string]int{},
+		waking:   map[string]time.Time{},
+		stuck:    map[string]bool{},
+		pending:  map[string][]notification{},
+		ready:    make(chan struct{}, 1),
+	}
+	n.send = n.sendSMTP
+	return n
+}
+
+// Run handles the events published on bus until ctx is done, and sends
+// the pending notifications before returning. Emails are sent from here,
+// never from the event bus; failed sends are retried with exponential
+// backoff.
+func (n *Notifier) Run(ctx context.Context, bus *events.Bus) {
+	if n == nil {
+		return
+	}
+	go bus.Follow(ctx, n.handle)
+
+	check := time.NewTicker(checkInterval)
+	defer check.Stop()
+	var digest <-chan time.Time
+	if n.cfg.DigestInterval > 0 {
+		t := time.NewTicker(n.cfg.DigestInterval)
+		defer t.Stop()
+		digest = t.C
+	}
+
+	attempt := 0
+	var retry <-chan time.Time
+	send := func() {
+		if n.flush() {
+			attempt, retry = 0, nil
+			return
+		}
+		wait := backoff(attempt)
+		attempt++
+		slog.Warn("email not sent, retrying", "retry_in", wait)
+		retry = time.After(wait)
+	}
+	for {
+		select {
+		case <-check.C:
+			n.checkStuck(time.Now())
+		case <-digest:
+			send()
+		case <-n.ready:
+			// While backing off, new notifications wait for the retry.
+			if retry == nil {
+				send()
+			}
+		case <-retry:
+			send()
+		case <-ctx.Done():
+			n.flush()
+			return
+		}
+	}
+}
+
+func backoff(attempt int) time.Duration {
+	d := firstBackoff << attempt
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+// notify wakes Run to send right away when there is no digest.
+func (n *Notifier) notify() {
+	if n.cfg.DigestInterval > 0 {
+		return
+	}
+	select {
+	case n.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Notifier) handle(e events.Event) {
+	n.mu.Lock()
+	switch e.Type {
+	case events.TypeWaking:
+		if _, ok := n.waking[e.Service]; !ok {
+			n.waking[e.Service] = e.Time
+		}
+	case events.TypeReady:
+		delete(n.waking, e.Service)
+		failures := n.failures[e.Service]
+		delete(n.failures, e.Service)
+		wasStuck := n.stuck[e.Service]
+		delete(n.stuck, e.Service)
+		if failures >= n.threshold() || wasStuck {
+			n.add(e.Time, e.Service, "Service "+e.Service+" is ready again", e.Message())
+		}
+	case events.TypeFailed:
+		delete(n.waking, e.Service)
+		n.failures[e.Service]++
+		if count := n.failures[e.Service]; count == n.threshold() {
+			n.add(e.Time, e.Service,
+				fmt.Sprintf("Service %s failed to start %d times in a row", e.Service, count),
+				fmt.Sprintf("The last %d attempts to start service %s failed. Last error:\n\n%s", count, e.Service, e.Detail))
+		}
+	case events.TypeConfigChanged:
+		if e.Detail == audit.ActionDelete {
+			delete(n.waking, e.Service)
+			delete(n.failures, e.Service)
+			delete(n.stuck, e.Service)
+		}
+	}
+	if slices.Contains(n.cfg.Events, e.Type) {
+		n.add(e.Time, e.Service, e.Message(), e.Message())
+	}
+	n.mu.Unlock()
+	n.notify()
+}
+
+func (n *Notifier) threshold() int {
+	if n.cfg.FailureThreshold > 0 {
+		return n.cfg.FailureThreshold
+	}
+	return defaultFailureThreshold
+}
+
+// checkStuck reports services that have been starting for longer than
+// their startup timeout without becoming ready or failing.
+func (n *Notifier) checkStuck(now time.Time) {
+	n.mu.Lock()
+	for name, since := range n.waking {
+		if n.stuck[name] {
+			continue
+		}
+		info, ok := n.lookup(name)
+		if !ok {
+			delete(n.waking, name)
+			continue
+		}
+		timeout := info.StartupTimeout
+		if timeout <= 0 {
+			timeout = defaultStartupTimeout
+		}
+		if now.Sub(since) < timeout+stuckGrace {
+			continue
+		}
+		n.stuck[name] = true
+		elapsed := now.Sub(since).Round(time.Second)
+		n.add(now, name,
+			fmt.Sprintf("Service %s is stuck starting", name),
+			fmt.Sprintf("Service %s has been starting for %s, longer than its startup timeout of %s, and has not become ready.", name, elapsed, timeout))
+	}
+	n.mu.Unlock()
+	n.notify()
+}
+
+// add queues a notification for the recipients of the service. It is
+// called with n.mu held.
+func (n *Notifier) add(t time.Time, service, subject, text string) {
+	recipients := slices.Clone(n.cfg.To)
+	if service != "" {
+		if info, ok := n.lookup(service); ok {
+			recipients = append(recipients, info.Recipients...)
+		}
+	}
+	slices.Sort(recipients)
+	recipients = slices.Compact(recipients)
+
+	item := notification{time: t, subject: subject, text: text}
+	for _, r := range recipients {
+		q := append(n.pending[r], item)
+		if len(q) > maxPending {
+			q = q[len(q)-maxPending:]
+		}
+		n.pending[r] = q
+	}
+}
+
+// flush sends one email per recipient with everything pending for it, and
+// reports whether all were sent. Notifications that could not be sent are
+// kept for the next attempt.
+func (n *Notifier) flush() bool {
+	n.mu.Lock()
+	pending := n.pending
+	n.pending = map[string][]notification{}
+	n.mu.Unlock()
+
+	ok := true
+	for to, items := range pending {
+		if err := n.send([]string{to}, n.compose(to, items)); err != nil {
+			slog.Error("send email", "to", to, "notifications", len(items), "err", err)
+			n.mu.Lock()
+			q := append(items, n.pending[to]...)
+			if len(q) > maxPending {
+				q = q[len(q)-maxPending:]
+			}
+			n.pending[to] = q
+			n.mu.Unlock()
+			ok = false
+			continue
+		}
+		slog.Debug("sent email", "to", to, "notifications", len(items))
+	}
+	return ok
+}
+
+func (n *Notifier) compose(to string, items []notification) []byte {
+	subject := items[0].subject
+	if len(items) > 1 {
+		subject = fmt.Sprintf("%d notifications", len(items))
+	}
+
+	var body bytes.Buffer
+	for i, it := range items {
+		if len(items) > 1 {
+			if i > 0 {
+				body.WriteString("\n\n")
+			}
+			fmt.Fprintf(&body, "%s  %s\n", it.time.Format(time.RFC3339), it.subject)
+			body.WriteString(strings.Repeat("-", 72) + "\n")
+		}
+		body.WriteString(it.text)
+		body.WriteString("\n")
+	}
+
+	var msg bytes.Buffer
+	header := func(k, v string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", k, stripNewlines(v))
+	}
+	header("From", n.cfg.From)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", "[Conslee] "+subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(n.cfg.From))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	msg.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	_, _ = qp.Write(body.Bytes())
+	_ = qp.Close()
+	return msg.Bytes()
+}
+
+func stripNewlines(s string) string {
+	return strings.NewReplacer("\r", "", "\n", " ").Replace(s)
+}
+
+func messageID(from string) string {
+	domain := "conslee"
+	if _, d, ok := strings.Cut(addressOf(from), "@"); ok {
+		domain = d
+	}
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// sendSMTP delivers a message with STARTTLS (the default), implicit TLS or
+// no encryption. Credentials are only sent over TLS or to localhost.
+func (n *Notifier) sendSMTP(to []string, msg []byte) error {
+	host := n.cfg.Host
+	port := n.cfg.Port
+	if port == 0 {
+		port = 587
+		if n.cfg.TLS == "tls" {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: host}
+
+	var conn net.Conn
+	var err error
+	if n.cfg.TLS == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, dialTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(sendTimeout))
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if n.cfg.TLS == "" || n.cfg.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS; set tls to none to send unencrypted", addr)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if n.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(addressOf(n.cfg.From)); err != nil {
+		return err
+	}
+	for _, r := range to {
+		if err := c.Rcpt(addressOf(r)); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// addressOf takes the address out of "Name <addr>".
+func addressOf(s string) string {
+	if a, err := mail.ParseAddress(s); err == nil {
+		return a.Address
+	}
+	return s
+}
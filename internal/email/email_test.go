@@ -0,0 +1,143 @@
+package email
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"conslee/internal/config"
+)
+
+// smtpSession is what a fakeSMTP server received in one connection.
+type smtpSession struct {
+	auth string
+	from string
+	rcpt []string
+	data string
+}
+
+// fakeSMTP accepts one connection and speaks just enough SMTP for
+// sendSMTP.
+func fakeSMTP(t *testing.T, extensions ...string) (port int, got <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	ch := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var s smtpSession
+		defer func() { ch <- s }()
+
+		_ = tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(cmd) {
+			case "EHLO":
+				for _, ext := range append([]string{"fake"}, extensions...) {
+					_ = tp.PrintfLine("250-%s", ext)
+				}
+				_ = tp.PrintfLine("250 HELP")
+			case "AUTH":
+				resp, _ := strings.CutPrefix(arg, "PLAIN ")
+				b, _ := base64.StdEncoding.DecodeString(resp)
+				s.auth = string(b)
+				_ = tp.PrintfLine("235 ok")
+			case "MAIL":
+				s.from = arg
+				_ = tp.PrintfLine("250 ok")
+			case "RCPT":
+				s.rcpt = append(s.rcpt, arg)
+				_ = tp.PrintfLine("250 ok")
+			case "DATA":
+				_ = tp.PrintfLine("354 go ahead")
+				b, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				s.data = string(b)
+				_ = tp.PrintfLine("250 queued")
+			case "QUIT":
+				_ = tp.PrintfLine("221 bye")
+				return
+			default:
+				_ = tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, ch
+}
+
+func TestSendSMTP(t *testing.T) {
+	port, got := fakeSMTP(t, "AUTH PLAIN")
+	n := New(config.EmailConfig{
+		Enabled:  true,
+		Host:     "127.0.0.1",
+		Port:     port,
+		TLS:      "none",
+		Username: "conslee",
+		Password: "secret",
+		From:     "Conslee <conslee@example.com>",
+	}, func(string) (ServiceInfo, bool) { return ServiceInfo{}, false })
+
+	msg := n.compose("ops@example.com", []notification{{subject: "web failed", text: "web did not start"}})
+	if err := n.sendSMTP([]string{"Ops <ops@example.com>"}, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	s := <-got
+	if s.auth != "\x00conslee\x00secret" {
+		t.Errorf("auth = %q", s.auth)
+	}
+	if s.from != "FROM:<conslee@example.com>" {
+		t.Errorf("mail %q", s.from)
+	}
+	if len(s.rcpt) != 1 || s.rcpt[0] != "TO:<ops@example.com>" {
+		t.Errorf("rcpt %q", s.rcpt)
+	}
+	m, err := textproto.NewReader(bufio.NewReader(strings.NewReader(s.data))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("parse message: %v\n%s", err, s.data)
+	}
+	if subj := m.Get("Subject"); subj != "[Conslee] web failed" {
+		t.Errorf("subject = %q", subj)
+	}
+	if !strings.Contains(s.data, "web did not start") {
+		t.Errorf("body missing in\n%s", s.data)
+	}
+}
+
+func TestSendSMTPRequiresSTARTTLS(t *testing.T) {
+	port, got := fakeSMTP(t, "AUTH PLAIN")
+	n := New(config.EmailConfig{
+		Enabled:  true,
+		Host:     "127.0.0.1",
+		Port:     port,
+		Username: "conslee",
+		Password: "secret",
+		From:     "conslee@example.com",
+	}, nil)
+
+	err := n.sendSMTP([]string{"ops@example.com"}, []byte("Subject: x\r\n\r\nx\r\n"))
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("err = %v, want missing STARTTLS", err)
+	}
+	if s := <-got; s.auth != "" || s.from != "" {
+		t.Errorf("sent over a plain connection: %+v", s)
+	}
+}
@@ -0,0 +1,223 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Service lifecycle events
+
+const (
+	TypeWaking          = "waking"
+	TypeReady           = "ready"
+	TypeIdleStopped     = "idle-stopped"
+	TypeScheduleStopped = "schedule-stopped"
+	TypeFailed          = "failed"
+	TypeConfigChanged   = "config-changed"
+	TypeContainer       = "container"
+)
+
+// Container states reported in container events.
+const (
+	StateRunning = "running"
+	StateStopped = "stopped"
+	StatePaused  = "paused"
+)
+
+const (
+	// recentSize is how many events are kept for subscribers that reconnect.
+	recentSize = 256
+	// bufferSize is how far a subscriber may fall behind before it is
+	// dropped.
+	bufferSize = 64
+)
+
+type Event struct {
+	ID        uint64    `json:"id"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Service   string    `json:"service,omitempty"`
+	Container string    `json:"container,omitempty"`
+	State     string    `json:"state,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// Subscription receives events on C. C is closed when the subscriber falls
+// too far behind or the bus is closed.
+type Subscription struct {
+	C <-chan Event
+
+	ch chan Event
+}
+
+// Bus fans events out to subscribers. A nil *Bus discards events.
+type Bus struct {
+	mu     sync.Mutex
+	nextID uint64
+	recent []Event
+	subs   map[*Subscription]struct{}
+	closed bool
+	done   chan struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[*Subscription]struct{}{}, done: make(chan struct{})}
+}
+
+// Publish assigns the event an ID and, if unset, a time.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.nextID++
+	e.ID = b.nextID
+	if len(b.recent) == recentSize {
+		copy(b.recent, b.recent[1:])
+		b.recent = b.recent[:recentSize-1]
+	}
+	b.recent = append(b.recent, e)
+
+	for s := range b.subs {
+		select {
+		case s.ch <- e:
+		default:
+			// Dropping the subscriber makes the client reconnect and
+			// catch up from the recent events, instead of silently
+			// missing one.
+			delete(b.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+// Subscribe returns a subscription and the recent events after lastID,
+// which the subscriber has not seen yet. lastID 0 means none.
+func (b *Bus) Subscribe(lastID uint64) (*Subscription, []Event) {
+	ch := make(chan Event, bufferSize)
+	s := &Subscription{C: ch, ch: ch}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return s, nil
+	}
+	b.subs[s] = struct{}{}
+
+	var missed []Event
+	if lastID > 0 {
+		for _, e := range b.recent {
+			if e.ID > lastID {
+				missed = append(missed, e)
+			}
+		}
+	}
+	return s, missed
+}
+
+func (b *Bus) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
+
+// Close ends all subscriptions, so that open streams let the server shut
+// down.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.done)
+	for s := range b.subs {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
+
+// Done is closed when the bus is closed.
+func (b *Bus) Done() <-chan struct{} {
+	return b.done
+}
+
+// Follow calls fn for each event until ctx is done or the bus is closed.
+// When fn falls behind and the subscription is dropped, Follow subscribes
+// again and catches up from the recent events.
+func (b *Bus) Follow(ctx context.Context, fn func(Event)) {
+	var lastID uint64
+	for {
+		sub, missed := b.Subscribe(lastID)
+		for _, e := range missed {
+			fn(e)
+			lastID = e.ID
+		}
+	read:
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					break read
+				}
+				fn(e)
+				lastID = e.ID
+			case <-ctx.Done():
+				b.Unsubscribe(sub)
+				return
+			}
+		}
+		select {
+		case <-b.Done():
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+// Message describes an event in a sentence.
+func (e Event) Message() string {
+	var m string
+	switch e.Type {
+	case TypeWaking:
+		m = "Service " + e.Service + " is starting"
+	case TypeReady:
+		m = "Service " + e.Service + " is ready"
+	case TypeFailed:
+		m = "Service " + e.Service + " failed to start"
+	case TypeIdleStopped:
+		m = "Service " + e.Service + " was stopped after being idle"
+	case TypeScheduleStopped:
+		m = "Service " + e.Service + " was stopped by its schedule"
+	case TypeConfigChanged:
+		if e.Service == "" {
+			m = "System settings changed"
+		} else {
+			m = "Configuration of service " + e.Service + " changed"
+		}
+	case TypeContainer:
+		m = "Container " + e.Container + " is " + e.State
+	default:
+		m = e.Type
+	}
+	if e.Detail != "" {
+		m += ": " + e.Detail
+	}
+	return m
+}
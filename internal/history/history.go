@@ -0,0 +1,176 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"conslee/internal/events"
+)
+
+// Per-service event history
+
+const (
+	// Size is how many events are kept per service.
+	Size = 200
+
+	defaultLimit = 50
+)
+
+// Store keeps the most recent events of each service in memory, and in a
+// file of JSON lines so they survive restarts. The file is rewritten with
+// only the kept events once it has grown to twice their number. A nil
+// *Store keeps nothing.
+type Store struct {
+	mu     sync.Mutex
+	path   string
+	events map[string][]events.Event
+	kept   int // events in memory
+	lines  int // lines in the file
+}
+
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create event history directory: %w", err)
+	}
+	s := &Store{path: path, events: map[string][]events.Event{}}
+
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("open event history: %w", err)
+	}
+	if err == nil {
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for sc.Scan() {
+			var e events.Event
+			if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.Service == "" {
+				continue
+			}
+			s.keep(e)
+		}
+		err = sc.Err()
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read event history: %w", err)
+		}
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, fmt.Errorf("write event history: %w", err)
+	}
+	return s, nil
+}
+
+// keep adds e to the events in memory. It is called with s.mu held.
+func (s *Store) keep(e events.Event) {
+	list := append(s.events[e.Service], e)
+	if len(list) > Size {
+		list = list[len(list)-Size:]
+	} else {
+		s.kept++
+	}
+	s.events[e.Service] = list
+}
+
+// Add records an event of a service; events without one are ignored.
+func (s *Store) Add(e events.Event) error {
+	if s == nil || e.Service == "" {
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keep(e)
+	if s.lines+1 > 2*s.kept {
+		return s.compact()
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.lines++
+	return f.Close()
+}
+
+// Forget drops the history of a deleted service.
+func (s *Store) Forget(service string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.events[service]; !ok {
+		return nil
+	}
+	s.kept -= len(s.events[service])
+	delete(s.events, service)
+	return s.compact()
+}
+
+// compact rewrites the file with the kept events. It is called with s.mu
+// held.
+func (s *Store) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".events-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, list := range s.events {
+		for _, e := range list {
+			if err := enc.Encode(e); err != nil {
+				_ = tmp.Close()
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.lines = s.kept
+	return nil
+}
+
+// Get returns up to limit events of a service, newest first.
+func (s *Store) Get(service string, limit int) []events.Event {
+	if s == nil {
+		return nil
+	}
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.events[service]
+	out := make([]events.Event, 0, min(limit, len(list)))
+	for i := len(list) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, list[i])
+	}
+	return out
+}
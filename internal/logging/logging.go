@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+
+	"conslee/internal/config"
+)
+
+// Leveled, structured logging
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	level   = new(slog.LevelVar)
+	useJSON atomic.Bool
+)
+
+// Setup makes slog's default logger, and with it the standard log package,
+// write to stderr with the configured level and format.
+func Setup(cfg config.LogConfig) error {
+	if err := Apply(cfg); err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(newHandler(os.Stderr)))
+	return nil
+}
+
+// Apply changes the level and format of the loggers created by Setup. It
+// takes effect for loggers derived with With as well.
+func Apply(cfg config.LogConfig) error {
+	l, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	if !config.ValidLogFormat(cfg.Format) {
+		return fmt.Errorf("invalid log format %q", cfg.Format)
+	}
+	level.Set(l)
+	useJSON.Store(cfg.Format == FormatJSON)
+	return nil
+}
+
+func ParseLevel(s string) (slog.Level, error) {
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if !config.ValidLogLevel(s) {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, err
+	}
+	return l, nil
+}
+
+// switchHandler keeps a text and a JSON handler with the same attributes
+// and passes records to the one currently selected.
+type switchHandler struct {
+	text slog.Handler
+	json slog.Handler
+}
+
+func newHandler(w io.Writer) *switchHandler {
+	opts := &slog.HandlerOptions{Level: level}
+	return &switchHandler{
+		text: slog.NewTextHandler(w, opts),
+		json: slog.NewJSONHandler(w, opts),
+	}
+}
+
+func (h *switchHandler) current() slog.Handler {
+	if useJSON.Load() {
+		return h.json
+	}
+	return h.text
+}
+
+func (h *switchHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+func (h *switchHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.current().Handle(ctx, r)
+}
+
+func (h *switchHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &switchHandler{text: h.text.WithAttrs(attrs), json: h.json.WithAttrs(attrs)}
+}
+
+func (h *switchHandler) WithGroup(name string) slog.Handler {
+	return &switchHandler{text: h.text.WithGroup(name), json: h.json.WithGroup(name)}
+}
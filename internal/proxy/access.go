@@ -0,0 +1,252 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"conslee/internal/auth"
+	"conslee/internal/config"
+)
+
+// Service access policies
+
+const (
+	defaultForwardAuthTimeout = 5 * time.Second
+	basicAuthCacheTTL         = 5 * time.Minute
+)
+
+var defaultForwardAuthHeaders = []string{"Remote-User", "Remote-Groups", "Remote-Name", "Remote-Email"}
+
+// identityHeaders are set by Conslee for the upstream; copies sent by the
+// client are removed so they cannot be spoofed.
+var identityHeaders = []string{"Remote-User", "Remote-Groups"}
+
+// basicAuthCache remembers recently verified credentials, so bcrypt does not
+// run on every request of a protected service.
+type basicAuthCache struct {
+	mu      sync.Mutex
+	entries map[[32]byte]time.Time
+}
+
+func (b *basicAuthCache) ok(key [32]byte) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	exp, found := b.entries[key]
+	if !found {
+		return false
+	}
+	if time.Now().After(exp) {
+		delete(b.entries, key)
+		return false
+	}
+	return true
+}
+
+func (b *basicAuthCache) add(key [32]byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.entries == nil {
+		b.entries = map[[32]byte]time.Time{}
+	}
+	now := time.Now()
+	for k, exp := range b.entries {
+		if now.After(exp) {
+			delete(b.entries, k)
+		}
+	}
+	b.entries[key] = now.Add(basicAuthCacheTTL)
+}
+
+// checkAccess enforces the service auth policy. It writes the response and
+// returns false when the request must not reach the service.
+func (c *Conslee) checkAccess(w http.ResponseWriter, r *http.Request, svc *ServiceState) bool {
+	cfg := svc.Config()
+	ac := cfg.Auth
+	if ac == nil {
+		return true
+	}
+	for _, h := range identityHeaders {
+		r.Header.Del(h)
+	}
+
+	switch ac.Type {
+	case "basic":
+		return c.checkBasicAuth(w, r, svc, ac)
+	case "sso":
+		return c.checkSSO(w, r, svc, ac)
+	case "forward_auth":
+		return c.checkForwardAuth(w, r, svc, ac)
+	default:
+		slog.Error("unknown auth type", "service", cfg.Name, "type", ac.Type)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+}
+
+func (c *Conslee) checkBasicAuth(w http.ResponseWriter, r *http.Request, svc *ServiceState, ac *config.ServiceAuthConfig) bool {
+	cfg := svc.Config()
+	username, password, ok := r.BasicAuth()
+	if ok {
+		key := sha256.Sum256([]byte(cfg.Name + "\x00" + username + "\x00" + password))
+		if svc.basicAuth.ok(key) || checkUserPassword(ac.Users, username, password) {
+			svc.basicAuth.add(key)
+			r.Header.Del("Authorization")
+			r.Header.Set("Remote-User", username)
+			return true
+		}
+		slog.Warn("basic auth failed", "service", cfg.Name, "user", username, "client", getClientIP(r))
+	}
+
+	realm := ac.Realm
+	if realm == "" {
+		realm = cfg.Name
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+strings.ReplaceAll(realm, `"`, "")+`", charset="UTF-8"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+func checkUserPassword(users []config.UserConfig, username, password string) bool {
+	hash := ""
+	for _, u := range users {
+		if u.Username == username {
+			hash = u.PasswordHash
+			break
+		}
+	}
+	return auth.ComparePassword(hash, password)
+}
+
+func (c *Conslee) checkSSO(w http.ResponseWriter, r *http.Request, svc *ServiceState, ac *config.ServiceAuthConfig) bool {
+	p := c.auth.SessionPrincipal(r)
+	if p == nil {
+		loginURL := ""
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			loginURL = c.auth.LoginURL(requestURL(r))
+		}
+		if loginURL != "" {
+			http.Redirect(w, r, loginURL, http.StatusFound)
+		} else {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+		return false
+	}
+
+	role := auth.RoleViewer
+	if ac.Role != "" {
+		role = auth.Role(ac.Role)
+	}
+	if !p.HasRole(role) || !p.CanView(*svc.Config()) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+
+	stripCookie(r, auth.SessionCookie)
+	r.Header.Set("Remote-User", p.Name)
+	if len(p.Groups) > 0 {
+		r.Header.Set("Remote-Groups", strings.Join(p.Groups, ","))
+	}
+	return true
+}
+
+// checkForwardAuth asks an external endpoint (Authelia, Authentik, oauth2-proxy
+// ...) about the request. A 2xx answer lets it through; anything else is
+// returned to the client as is, e.g. a redirect to the login portal.
+func (c *Conslee) checkForwardAuth(w http.ResponseWriter, r *http.Request, svc *ServiceState, ac *config.ServiceAuthConfig) bool {
+	fa := ac.ForwardAuth
+	timeout := fa.Timeout
+	if timeout <= 0 {
+		timeout = defaultForwardAuthTimeout
+	}
+
+	cfg := svc.Config()
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, fa.URL, nil)
+	if err != nil {
+		slog.Error("forward auth request", "service", cfg.Name, "err", err)
+		http.Error(w, "forward auth unavailable", http.StatusBadGateway)
+		return false
+	}
+	for _, h := range []string{"Cookie", "Authorization", "Accept", "User-Agent"} {
+		if v := r.Header.Values(h); len(v) > 0 {
+			req.Header[h] = v
+		}
+	}
+	req.Header.Set("X-Forwarded-Method", r.Method)
+	req.Header.Set("X-Forwarded-Proto", requestScheme(r))
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	req.Header.Set("X-Forwarded-Uri", r.URL.RequestURI())
+	req.Header.Set("X-Forwarded-For", getClientIP(r))
+	req.Header.Set("X-Original-URL", requestURL(r))
+	req.Header.Set("X-Original-Method", r.Method)
+
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Error("forward auth", "service", cfg.Name, "err", err)
+		http.Error(w, "forward auth unavailable", http.StatusBadGateway)
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		headers := fa.ResponseHeaders
+		if len(headers) == 0 {
+			headers = defaultForwardAuthHeaders
+		}
+		for _, h := range headers {
+			r.Header.Del(h)
+			if v := resp.Header.Values(h); len(v) > 0 {
+				r.Header[http.CanonicalHeaderKey(h)] = v
+			}
+		}
+		return true
+	}
+
+	for _, h := range []string{"Location", "WWW-Authenticate", "Content-Type", "Set-Cookie"} {
+		if v := resp.Header.Values(h); len(v) > 0 {
+			w.Header()[h] = v
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+	return false
+}
+
+func requestScheme(r *http.Request) string {
+	if v := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); v == "https" || v == "http" {
+		return v
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// requestURL reconstructs the URL the client asked for.
+func requestURL(r *http.Request) string {
+	u := url.URL{Scheme: requestScheme(r), Host: r.Host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+	return u.String()
+}
+
+// stripCookie removes one cookie from the request before it is proxied.
+func stripCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, ck := range cookies {
+		if ck.Name != name {
+			r.AddCookie(ck)
+		}
+	}
+}
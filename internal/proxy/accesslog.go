@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"conslee/internal/accesslog"
+)
+
+// Per-request bookkeeping for the access log
+
+type requestInfoKey struct{}
+
+type requestInfo struct {
+	woke     atomic.Bool
+	upstream atomic.Int64 // nanoseconds spent in upstream round trips
+}
+
+func withRequestInfo(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// finishRequest records a proxied request in the metrics and access log.
+func (c *Conslee) finishRequest(svc *ServiceState, r *http.Request, rec *statusRecorder, info *requestInfo, start time.Time) {
+	observeRequest(svc, r, rec, start)
+	if c.accessLog == nil {
+		return
+	}
+
+	cfg := svc.Config()
+	e := &accesslog.Entry{
+		Time:            start,
+		Service:         cfg.Name,
+		Host:            r.Host,
+		Method:          r.Method,
+		Path:            r.URL.Path,
+		Proto:           r.Proto,
+		Status:          rec.code(),
+		Bytes:           rec.bytes,
+		Duration:        time.Since(start),
+		UpstreamLatency: time.Duration(info.upstream.Load()),
+		Wake:            info.woke.Load(),
+		ClientIP:        getClientIP(r),
+		Referer:         r.Referer(),
+		UserAgent:       r.UserAgent(),
+	}
+	// Remote-User is only trustworthy once an access policy has set it.
+	if cfg.Auth != nil {
+		e.User = r.Header.Get("Remote-User")
+	}
+	c.accessLog.Log(e)
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"conslee/internal/audit"
+	"conslee/internal/auth"
+)
+
+// Audit log
+
+// record writes an audit entry for a management API call.
+func (c *Conslee) record(r *http.Request, action, service string, changes []audit.Change) {
+	c.recordAs(actorOf(r), action, service, "", changes)
+}
+
+// actorOf names the caller of a management API request.
+func actorOf(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p.Name
+	}
+	return "anonymous"
+}
+
+// recordAs writes an audit entry for an action Conslee took on its own.
+func (c *Conslee) recordAs(actor, action, service, detail string, changes []audit.Change) {
+	err := c.audit.Append(audit.Entry{
+		Actor:   actor,
+		Action:  action,
+		Service: service,
+		Detail:  detail,
+		Changes: changes,
+	})
+	if err != nil {
+		slog.Error("write audit log", "service", service, "action", action, "err", err)
+	}
+}
+
+// GET /api/audit?service=&actor=&action=&since=&until=&limit=
+func (c *Conslee) HandleAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := audit.Filter{
+		Service: q.Get("service"),
+		Actor:   q.Get("actor"),
+		Action:  q.Get("action"),
+	}
+	for _, t := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(t.name); v != "" {
+			ts, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "invalid "+t.name+", expected RFC 3339", http.StatusBadRequest)
+				return
+			}
+			*t.dst = ts
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		f.Limit = n
+	}
+
+	// Admins see everything; others only entries of services they can
+	// currently see.
+	p := auth.FromContext(r.Context())
+	var keep func(*audit.Entry) bool
+	if !p.HasRole(auth.RoleAdmin) {
+		keep = func(e *audit.Entry) bool {
+			svc, ok := c.reg.GetByName(e.Service)
+			return ok && p.CanView(*svc.Config())
+		}
+	}
+
+	entries, err := c.audit.Query(f, keep)
+	if err != nil {
+		slog.Error("read audit log", "err", err)
+		http.Error(w, "cannot read audit log", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,418 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"conslee/internal/config"
+)
+
+// Request buffering
+
+const (
+	defaultBufferStatus      = http.StatusAccepted
+	defaultBufferMaxBodySize = 10 << 20
+	defaultBufferMemoryLimit = 1 << 20
+	defaultBufferMaxPending  = 100
+	defaultBufferMaxAge      = 10 * time.Minute
+
+	// replayRetryDelay is the pause after a failed wake or delivery.
+	replayRetryDelay = 5 * time.Second
+
+	bufferedHeader = "X-Conslee-Buffered"
+)
+
+var defaultBufferMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type bufferedRequest struct {
+	method     string
+	requestURI string
+	host       string
+	remoteAddr string
+	clientIP   string
+	header     http.Header
+	received   time.Time
+
+	body      []byte
+	spoolFile string
+	size      int64
+}
+
+func (b *bufferedRequest) openBody() (io.ReadCloser, error) {
+	if b.spoolFile != "" {
+		return os.Open(b.spoolFile)
+	}
+	return io.NopCloser(bytes.NewReader(b.body)), nil
+}
+
+func (b *bufferedRequest) discard() {
+	if b.spoolFile != "" {
+		_ = os.Remove(b.spoolFile)
+	}
+}
+
+// replayQueue holds the requests accepted while a service is starting. A
+// single worker per service wakes it and replays the queue in order.
+type replayQueue struct {
+	mu      sync.Mutex
+	pending []*bufferedRequest
+	active  bool
+}
+
+func (q *replayQueue) isActive() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.active
+}
+
+func bufferSettings(bc *config.BufferConfig) config.BufferConfig {
+	s := *bc
+	if s.Status == 0 {
+		s.Status = defaultBufferStatus
+	}
+	if len(s.Methods) == 0 {
+		s.Methods = defaultBufferMethods
+	}
+	if s.MaxBodySize <= 0 {
+		s.MaxBodySize = defaultBufferMaxBodySize
+	}
+	if s.MemoryLimit <= 0 {
+		s.MemoryLimit = defaultBufferMemoryLimit
+	}
+	if s.MaxPending <= 0 {
+		s.MaxPending = defaultBufferMaxPending
+	}
+	if s.MaxAge <= 0 {
+		s.MaxAge = defaultBufferMaxAge
+	}
+	if s.SpoolDir == "" {
+		s.SpoolDir = filepath.Join(os.TempDir(), "conslee-buffer")
+	}
+	return s
+}
+
+// shouldBuffer reports whether the request should be accepted and replayed
+// later instead of waiting for the service to start.
+func (c *Conslee) shouldBuffer(ctx context.Context, r *http.Request, svc *ServiceState) bool {
+	cfg := svc.Config()
+	bc := cfg.Buffer
+	if bc == nil || !bc.Enabled {
+		return false
+	}
+	settings := bufferSettings(bc)
+
+	methodOK := false
+	for _, m := range settings.Methods {
+		if strings.EqualFold(m, r.Method) {
+			methodOK = true
+			break
+		}
+	}
+	if !methodOK {
+		return false
+	}
+
+	if svc.replay.isActive() {
+		return true
+	}
+
+	running, err := isRunning(ctx, c.rt, svc)
+	if err != nil {
+		slog.Warn("inspect service", "service", cfg.Name, "action", "buffer", "err", err)
+		return false
+	}
+	return !running
+}
+
+func (c *Conslee) bufferRequest(w http.ResponseWriter, r *http.Request, svc *ServiceState) {
+	cfg := svc.Config()
+	settings := bufferSettings(cfg.Buffer)
+
+	if r.ContentLength > settings.MaxBodySize {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	br := &bufferedRequest{
+		method:     r.Method,
+		requestURI: r.URL.RequestURI(),
+		host:       r.Host,
+		remoteAddr: r.RemoteAddr,
+		clientIP:   getClientIP(r),
+		header:     r.Header.Clone(),
+		received:   time.Now(),
+	}
+
+	if err := readBufferedBody(br, r.Body, settings); err != nil {
+		if errors.Is(err, errBodyTooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		slog.Error("read request body", "service", cfg.Name, "action", "buffer", "err", err)
+		http.Error(w, "cannot buffer request", http.StatusInternalServerError)
+		return
+	}
+
+	q := &svc.replay
+	q.mu.Lock()
+	if len(q.pending) >= settings.MaxPending {
+		q.mu.Unlock()
+		br.discard()
+		w.Header().Set("Retry-After", strconv.Itoa(int(cfg.StartupTimeout.Seconds())+1))
+		http.Error(w, "too many buffered requests", http.StatusServiceUnavailable)
+		return
+	}
+	q.pending = append(q.pending, br)
+	startWorker := !q.active
+	q.active = true
+	q.mu.Unlock()
+
+	svc.LastActivity = time.Now()
+	slog.Info("buffered request while service starts", "service", cfg.Name, "action", "buffer", "method", br.method, "uri", br.requestURI, "bytes", br.size)
+
+	if startWorker {
+		go c.replayWorker(svc)
+	}
+
+	w.Header().Set(probeSignatureHeader, cfg.Name)
+	w.Header().Set(bufferedHeader, "true")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(settings.Status)
+	_, _ = io.WriteString(w, "request accepted; it will be delivered once the service has started\n")
+}
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// readBufferedBody keeps small bodies in memory and spools larger ones to a
+// temporary file.
+func readBufferedBody(br *bufferedRequest, body io.Reader, settings config.BufferConfig) error {
+	limited := io.LimitReader(body, settings.MaxBodySize+1)
+
+	head, err := io.ReadAll(io.LimitReader(limited, settings.MemoryLimit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(head)) <= settings.MemoryLimit {
+		br.body = head
+		br.size = int64(len(head))
+		return nil
+	}
+
+	if err := os.MkdirAll(settings.SpoolDir, 0o700); err != nil {
+		return fmt.Errorf("create spool dir: %w", err)
+	}
+	f, err := os.CreateTemp(settings.SpoolDir, "req-*")
+	if err != nil {
+		return fmt.Errorf("create spool file: %w", err)
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, io.MultiReader(bytes.NewReader(head), limited))
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("write spool file: %w", err)
+	}
+	if n > settings.MaxBodySize {
+		_ = os.Remove(f.Name())
+		return errBodyTooLarge
+	}
+
+	br.spoolFile = f.Name()
+	br.size = n
+	return nil
+}
+
+// replayWorker wakes the service and delivers the buffered requests. Failed
+// wakes, and deliveries that failed before connecting, are retried until
+// they succeed or the request has outlived max_age.
+func (c *Conslee) replayWorker(svc *ServiceState) {
+	q := &svc.replay
+	name := svc.Config().Name
+
+	for {
+		settings := bufferSettings(svc.Config().Buffer)
+		c.dropExpired(svc, settings.MaxAge)
+
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.active = false
+			q.mu.Unlock()
+			return
+		}
+		first := q.pending[0]
+		q.mu.Unlock()
+
+		path, _, _ := strings.Cut(first.requestURI, "?")
+		trigger := "buffered " + wakeTrigger(first.method, first.host, path, first.clientIP)
+		if err := c.ensureRunning(context.Background(), svc, trigger); err != nil {
+			slog.Error("wake for replay failed", "service", name, "action", "replay", "err", err)
+			time.Sleep(replayRetryDelay)
+			continue
+		}
+
+		for {
+			q.mu.Lock()
+			if len(q.pending) == 0 {
+				q.mu.Unlock()
+				break
+			}
+			br := q.pending[0]
+			q.pending = q.pending[1:]
+			q.mu.Unlock()
+
+			if c.replay(svc, br) {
+				// Put it back in front; the service may have stopped or
+				// not be accepting connections yet.
+				q.mu.Lock()
+				q.pending = append([]*bufferedRequest{br}, q.pending...)
+				q.mu.Unlock()
+				time.Sleep(replayRetryDelay)
+				break
+			}
+			br.discard()
+		}
+	}
+}
+
+func (c *Conslee) dropExpired(svc *ServiceState, maxAge time.Duration) {
+	q := &svc.replay
+	now := time.Now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	kept := q.pending[:0]
+	for _, br := range q.pending {
+		if now.Sub(br.received) > maxAge {
+			slog.Warn("dropping buffered request", "service", svc.Config().Name, "action", "replay", "method", br.method, "uri", br.requestURI, "max_age", maxAge)
+			br.discard()
+			continue
+		}
+		kept = append(kept, br)
+	}
+	q.pending = kept
+}
+
+// notSent reports whether a round trip failed while connecting, before any
+// of the request was written.
+func notSent(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+// cleanSpool removes the bodies spooled by an earlier run; their requests
+// were lost with it.
+func cleanSpool(dir string) {
+	files, err := filepath.Glob(filepath.Join(dir, "req-*"))
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil {
+			slog.Warn("remove spooled request body", "file", f, "err", err)
+		}
+	}
+	if len(files) > 0 {
+		slog.Info("removed request bodies spooled before restart", "dir", dir, "count", len(files))
+	}
+}
+
+// hopHeaders are removed from replayed requests, as httputil.ReverseProxy
+// does for proxied ones.
+var hopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// removeHopHeaders removes the hop-by-hop headers, including those named in
+// Connection.
+func removeHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, f := range strings.Split(v, ",") {
+			if f = textproto.TrimString(f); f != "" {
+				h.Del(f)
+			}
+		}
+	}
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+}
+
+// replay delivers a buffered request. It reports whether delivery failed
+// before a connection was made, so that retrying cannot deliver it twice.
+func (c *Conslee) replay(svc *ServiceState, br *bufferedRequest) (retry bool) {
+	name, pool := svc.Config().Name, svc.Pool()
+
+	upstream := pool.Pick()
+	if upstream == nil {
+		slog.Error("replay: no target configured", "service", name, "action", "replay", "method", br.method, "uri", br.requestURI)
+		return false
+	}
+
+	body, err := br.openBody()
+	if err != nil {
+		slog.Error("replay: open body", "service", name, "action", "replay", "method", br.method, "uri", br.requestURI, "err", err)
+		return false
+	}
+	defer body.Close()
+
+	target := *upstream.URL
+	path, query, _ := strings.Cut(br.requestURI, "?")
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(path, "/")
+	target.RawPath = ""
+	target.RawQuery = query
+
+	ctx, cancel := context.WithTimeout(withClientIP(context.Background(), br.clientIP), 60*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, br.method, target.String(), body)
+	if err != nil {
+		slog.Error("replay: create request", "service", name, "action", "replay", "method", br.method, "uri", br.requestURI, "err", err)
+		return false
+	}
+	req.Header = br.header.Clone()
+	removeHopHeaders(req.Header)
+	req.Host = br.host
+	req.RemoteAddr = br.remoteAddr
+	req.ContentLength = br.size
+	if br.size == 0 {
+		// Otherwise the transport cannot tell the body is empty and sends
+		// it chunked.
+		req.Body = http.NoBody
+	}
+	setForwardedHeaders(req, req)
+
+	start := time.Now()
+	upstream.active.Add(1)
+	resp, err := pool.transport.RoundTrip(req)
+	upstream.active.Add(-1)
+	if err != nil {
+		pool.ReportFailure(upstream)
+		if notSent(err) {
+			slog.Warn("replay failed, will retry", "service", name, "action", "replay", "method", br.method, "uri", br.requestURI, "queued", start.Sub(br.received).Round(time.Millisecond), "err", err)
+			return true
+		}
+		// The service may have received the request; most buffered
+		// requests are not idempotent.
+		slog.Error("replay failed, dropping request", "service", name, "action", "replay", "method", br.method, "uri", br.requestURI, "queued", start.Sub(br.received).Round(time.Millisecond), "err", err)
+		return false
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	pool.ReportSuccess(upstream)
+
+	svc.LastActivity = time.Now()
+	slog.Info("replayed buffered request", "service", name, "action", "replay", "method", br.method, "uri", br.requestURI, "status", resp.StatusCode, "queued", start.Sub(br.received).Round(time.Millisecond))
+	return false
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"conslee/internal/config"
+)
+
+// Client addresses
+
+// forwardedHeaders are only honored when the peer is a trusted proxy.
+var forwardedHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "X-Real-IP"}
+
+type ipSet []netip.Prefix
+
+func newIPSet(list []string) ipSet {
+	prefixes, err := config.ParsePrefixes(list)
+	if err != nil {
+		// Load validates the lists, so this only happens for API input.
+		slog.Warn("invalid address list", "list", list, "err", err)
+		return nil
+	}
+	return prefixes
+}
+
+func (s ipSet) contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range s {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type clientIPKey struct{}
+
+func withClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// resolveClient drops forwarded headers unless the request comes from a
+// trusted proxy, and stores the resulting client IP in the request context.
+func (c *Conslee) resolveClient(r *http.Request) *http.Request {
+	peer := extractIPFromRemoteAddr(r.RemoteAddr)
+	if !c.trusted.contains(peer) {
+		for _, h := range forwardedHeaders {
+			r.Header.Del(h)
+		}
+		return r.WithContext(withClientIP(r.Context(), peer))
+	}
+	return r.WithContext(withClientIP(r.Context(), forwardedClientIP(r, peer, c.trusted)))
+}
+
+// forwardedClientIP walks X-Forwarded-For from the right and returns the
+// first address that is not a trusted proxy.
+func forwardedClientIP(r *http.Request, peer string, trusted ipSet) string {
+	var chain []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(v, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				chain = append(chain, ip)
+			}
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !trusted.contains(chain[i]) {
+			return chain[i]
+		}
+	}
+	if len(chain) > 0 {
+		return chain[0]
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	return peer
+}
+
+// Service IP filtering
+
+type ipRules struct {
+	allow ipSet
+	deny  ipSet
+}
+
+type ipRulesCache struct {
+	once  sync.Once
+	rules ipRules
+}
+
+func (s *ServiceState) ipRules() ipRules {
+	s.ipCache.once.Do(func() {
+		cfg := s.Config()
+		s.ipCache.rules = ipRules{
+			allow: newIPSet(cfg.AllowCIDRs),
+			deny:  newIPSet(cfg.DenyCIDRs),
+		}
+	})
+	return s.ipCache.rules
+}
+
+// clientAllowed applies deny_cidrs, then allow_cidrs when it is set.
+func (s *ServiceState) clientAllowed(ip string) bool {
+	rules := s.ipRules()
+	if rules.deny.contains(ip) {
+		return false
+	}
+	return len(s.Config().AllowCIDRs) == 0 || rules.allow.contains(ip)
+}
@@ -2,19 +2,46 @@ package proxy
 
 import (
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"sync"
 	"syscall"
-	"time"
 
+	"conslee/internal/accesslog"
+	"conslee/internal/audit"
+	"conslee/internal/auth"
 	"conslee/internal/config"
+	"conslee/internal/email"
+	"conslee/internal/events"
+	"conslee/internal/history"
+	"conslee/internal/usage"
+	"conslee/internal/webhook"
 )
 
 type Conslee struct {
-	rt  ContainerRuntime
-	reg *ServiceRegistry
+	rt    ContainerRuntime
+	reg   *ServiceRegistry
+	auth  *auth.Manager
+	audit *audit.Log
+	usage *usage.Store
+
+	// events feeds GET /api/events, the event history and the
+	// notifiers.
+	events   *events.Bus
+	history  *history.Store
+	webhooks *webhook.Dispatcher
+	email    *email.Notifier
+
+	accessLog *accesslog.Logger
+
+	// trusted are the proxies whose forwarded headers are honored.
+	trusted ipSet
+
+	// probeLimits rate-limits POST /api/probes per caller.
+	probeLimits *limitState
 
 	cfg        *config.Config
 	configPath string
@@ -27,40 +54,89 @@ type Conslee struct {
 // Initialization
 
 func New(cfg *config.Config, configPath string) (*Conslee, error) {
-	rt, err := NewDockerRuntime()
+	dockerRT, err := NewDockerRuntime()
 	if err != nil {
 		return nil, err
 	}
+	rt := instrumentedRuntime{dockerRT}
 	reg := NewRegistry()
 
 	for _, s := range cfg.Services {
-		var u *url.URL
-		if s.TargetURL != "" {
-			parsed, err := url.Parse(s.TargetURL)
-			if err != nil {
-				return nil, err
-			}
-			u = parsed
+		pool, err := NewUpstreamPool(s)
+		if err != nil {
+			return nil, err
 		}
-		st := &ServiceState{
-			Config:       s,
-			Target:       u,
-			LastActivity: time.Now(),
-			Schedule:     ParseSchedule(s.Schedule, s.Mode),
+		warnUnverifiedTLS(s, pool)
+		if s.Buffer != nil && s.Buffer.Enabled {
+			cleanSpool(bufferSettings(s.Buffer).SpoolDir)
 		}
-		reg.Add(s.Host, st)
+		reg.Add(s.Host, newServiceState(s, pool))
+	}
+
+	authMgr := auth.NewManager(cfg.Auth)
+	// After signing in, users may only be sent back to proxied services.
+	authMgr.SetRedirectPolicy(func(u *url.URL) bool {
+		_, ok := reg.GetByHost(u.Host)
+		return ok
+	})
+
+	auditLog, err := audit.Open(filepath.Join(dataDir(cfg, configPath), "audit.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	usageStore, err := usage.Open(filepath.Join(dataDir(cfg, configPath), "usage.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	eventHistory, err := history.Open(filepath.Join(dataDir(cfg, configPath), "events.log"))
+	if err != nil {
+		return nil, err
 	}
 
-	return &Conslee{
-		rt:         rt,
-		reg:        reg,
-		cfg:        cfg,
-		configPath: configPath,
-	}, nil
+	accessLog, err := accesslog.New(cfg.AccessLog)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := webhook.New(cfg.Webhooks)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conslee{
+		rt:          rt,
+		reg:         reg,
+		auth:        authMgr,
+		audit:       auditLog,
+		usage:       usageStore,
+		events:      events.NewBus(),
+		history:     eventHistory,
+		webhooks:    webhooks,
+		accessLog:   accessLog,
+		probeLimits: &limitState{clients: map[string]*clientLimiter{}},
+		trusted:     newIPSet(cfg.Server.TrustedProxies),
+		cfg:         cfg,
+		configPath:  configPath,
+	}
+	c.email = email.New(cfg.Email, c.emailServiceInfo)
+	if err := metricsRegistry.Register(newRunningCollector(c)); err != nil {
+		slog.Error("register running collector", "err", err)
+	}
+	return c, nil
 }
 
 // Config management
 
+// dataDir is where state files are kept.
+func dataDir(cfg *config.Config, configPath string) string {
+	if cfg.DataDir != "" {
+		return cfg.DataDir
+	}
+	return filepath.Dir(configPath)
+}
+
 func (c *Conslee) snapshotConfig() *config.Config {
 	if c.cfg == nil {
 		return nil
@@ -70,7 +146,7 @@ func (c *Conslee) snapshotConfig() *config.Config {
 
 	services := make([]config.ServiceConfig, 0, len(c.reg.All()))
 	for _, svc := range c.reg.All() {
-		services = append(services, svc.Config)
+		services = append(services, *svc.Config())
 	}
 	cfgCopy.Services = services
 
@@ -93,6 +169,17 @@ func (c *Conslee) saveConfig() error {
 	return config.Save(c.configPath, cfg)
 }
 
+// Auth returns the authentication manager guarding the management API.
+func (c *Conslee) Auth() *auth.Manager {
+	return c.auth
+}
+
+// ServesHost reports whether host belongs to a proxied service.
+func (c *Conslee) ServesHost(host string) bool {
+	_, ok := c.reg.GetByHost(host)
+	return ok
+}
+
 // Server management
 
 func (c *Conslee) SetServer(srv *http.Server) {
@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"conslee/internal/auth"
+	"conslee/internal/email"
+	"conslee/internal/events"
+)
+
+// Event stream
+
+const (
+	eventsHeartbeat = 25 * time.Second
+	eventsRetry     = 3 * time.Second
+	watchRetry      = 5 * time.Second
+	maxWatchRetry   = 2 * time.Minute
+)
+
+func (c *Conslee) publish(typ, service, detail string) {
+	c.events.Publish(events.Event{Type: typ, Service: service, Detail: detail})
+}
+
+// CloseEvents ends open event streams; it is called on server shutdown.
+func (c *Conslee) CloseEvents() {
+	c.events.Close()
+}
+
+// RunNotifiers delivers events to the configured webhooks and email
+// recipients until ctx is done.
+func (c *Conslee) RunNotifiers(ctx context.Context) {
+	go c.webhooks.Run(ctx, c.events)
+	c.email.Run(ctx, c.events)
+}
+
+func (c *Conslee) emailServiceInfo(name string) (email.ServiceInfo, bool) {
+	svc, ok := c.reg.GetByName(name)
+	if !ok {
+		return email.ServiceInfo{}, false
+	}
+	cfg := svc.Config()
+	return email.ServiceInfo{
+		Recipients:     cfg.NotifyEmail,
+		StartupTimeout: cfg.StartupTimeout,
+	}, true
+}
+
+// WatchContainers publishes container state changes reported by Docker
+// until ctx is done, reconnecting when the event stream breaks.
+func (c *Conslee) WatchContainers(ctx context.Context) {
+	retry := watchRetry
+	for {
+		evs, errs := c.rt.Events(ctx)
+	stream:
+		for {
+			select {
+			case ev, ok := <-evs:
+				if !ok {
+					break stream
+				}
+				retry = watchRetry
+				c.publishContainerEvent(ev)
+			case err := <-errs:
+				if ctx.Err() == nil {
+					slog.Warn("docker event stream failed", "err", err)
+				}
+				break stream
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-time.After(retry):
+		case <-ctx.Done():
+			return
+		}
+		retry = min(2*retry, maxWatchRetry)
+	}
+}
+
+// publishContainerEvent sends one event per service using the container,
+// or one without a service for containers Conslee does not manage.
+func (c *Conslee) publishContainerEvent(ev ContainerEvent) {
+	e := events.Event{Type: events.TypeContainer, Time: ev.Time, Container: ev.Name, State: ev.State}
+	found := false
+	for _, svc := range c.reg.All() {
+		if !slices.Contains(svc.ContainerNames(), ev.Name) {
+			continue
+		}
+		found = true
+		e.Service = svc.Config().Name
+		c.events.Publish(e)
+	}
+	if !found {
+		c.events.Publish(e)
+	}
+}
+
+// canSeeEvent applies the visibility of the services API to events. Events
+// of services that no longer exist are shown to admins only; events of
+// unmanaged containers to those who may list containers.
+func (c *Conslee) canSeeEvent(p *auth.Principal, e *events.Event) bool {
+	if p.HasRole(auth.RoleAdmin) {
+		return true
+	}
+	if e.Service == "" {
+		return e.Type != events.TypeContainer || p.HasRole(auth.RoleOperator)
+	}
+	svc, ok := c.reg.GetByName(e.Service)
+	return ok && p.CanView(*svc.Config())
+}
+
+// GET /api/events
+//
+// Server-Sent Events. Clients that reconnect with Last-Event-ID receive the
+// recent events they missed.
+func (c *Conslee) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// Streams outlive the server's write timeout.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var lastID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		lastID, _ = strconv.ParseUint(v, 10, 64)
+	}
+	sub, missed := c.events.Subscribe(lastID)
+	defer c.events.Unsubscribe(sub)
+
+	p := auth.FromContext(r.Context())
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+
+	send := func(e *events.Event) error {
+		if !c.canSeeEvent(p, e) {
+			return nil
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		return err
+	}
+
+	for i := range missed {
+		if err := send(&missed[i]); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := send(&e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
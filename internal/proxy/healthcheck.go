@@ -2,49 +2,59 @@ package proxy
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Health checks
 
-func waitTCP(ctx context.Context, hostPort string, timeout time.Duration) error {
+func waitTCP(ctx context.Context, hostPort string, timeout time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "waitTCP", attribute.String("server.address", hostPort))
+	defer func() { endSpan(span, err) }()
+	return waitDial(ctx, "tcp", hostPort, timeout)
+}
+
+// waitSocket waits until a unix socket accepts connections.
+func waitSocket(ctx context.Context, path string, timeout time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "waitSocket", attribute.String("conslee.socket", path))
+	defer func() { endSpan(span, err) }()
+	return waitDial(ctx, "unix", path, timeout)
+}
+
+func waitDial(ctx context.Context, network, addr string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 	for {
-		d, err := net.DialTimeout("tcp", hostPort, 2*time.Second)
+		d, err := net.DialTimeout(network, addr, 2*time.Second)
 		if err == nil {
 			_ = d.Close()
 			return nil
 		}
 		if time.Now().After(deadline) {
-			return fmt.Errorf("backend %s not listening by %s: %w", hostPort, timeout, err)
+			return fmt.Errorf("backend %s not listening by %s: %w", addr, timeout, err)
 		}
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("context cancelled waiting TCP %s: %w", hostPort, ctx.Err())
+			return fmt.Errorf("context cancelled waiting %s %s: %w", strings.ToUpper(network), addr, ctx.Err())
 		case <-time.After(1 * time.Second):
 		}
 	}
 }
 
-func waitHTTP(ctx context.Context, u *url.URL, path string, timeout time.Duration) error {
+func waitHTTP(ctx context.Context, client *http.Client, u *url.URL, path string, timeout time.Duration) (err error) {
 	if path == "" {
 		return nil
 	}
 	hu := *u
 	hu.Path = path
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy:           http.ProxyFromEnvironment,
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-		Timeout: 10 * time.Second,
-	}
+	ctx, span := startSpan(ctx, "waitHTTP", attribute.String("url.full", hu.String()))
+	defer func() { endSpan(span, err) }()
 
 	deadline := time.Now().Add(timeout)
 
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"conslee/internal/audit"
+	"conslee/internal/auth"
+	"conslee/internal/events"
+	"conslee/internal/history"
+)
+
+// Event history
+
+// RecordHistory keeps the events of each service until ctx is done.
+func (c *Conslee) RecordHistory(ctx context.Context) {
+	c.events.Follow(ctx, c.recordHistory)
+}
+
+func (c *Conslee) recordHistory(e events.Event) {
+	var err error
+	if e.Type == events.TypeConfigChanged && e.Detail == audit.ActionDelete {
+		err = c.history.Forget(e.Service)
+	} else {
+		err = c.history.Add(e)
+	}
+	if err != nil {
+		slog.Error("write event history", "service", e.Service, "event", e.Type, "err", err)
+	}
+}
+
+// GET /api/services/{name}/events?limit=
+//
+// The most recent events of the service, newest first.
+func (c *Conslee) HandleServiceEvents(w http.ResponseWriter, r *http.Request) {
+	name := extractServiceNameFromPath(r.URL.Path, "/events")
+	if name == "" {
+		http.Error(w, "service name required", http.StatusBadRequest)
+		return
+	}
+
+	svc, ok := c.reg.GetByName(name)
+	if !ok {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+	if !authorizeService(w, r, svc, (*auth.Principal).CanView) {
+		return
+	}
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > history.Size {
+			http.Error(w, "invalid limit, expected 0 to "+strconv.Itoa(history.Size), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(c.history.Get(name, limit))
+}
@@ -6,14 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
+	"conslee/internal/audit"
+	"conslee/internal/auth"
 	"conslee/internal/config"
+	"conslee/internal/events"
+	"conslee/internal/logging"
 )
 
 // Request types
@@ -27,7 +30,19 @@ type CreateServiceRequest struct {
 	IdleTimeout    string   `json:"idleTimeout"`
 	StartupTimeout string   `json:"startupTimeout"`
 	HealthPath     string   `json:"healthPath"`
-	Schedule       *struct {
+
+	TargetURLs        []string `json:"targetUrls,omitempty"`
+	ReplicaContainers []string `json:"replicaContainers,omitempty"`
+	LoadBalancer      string   `json:"loadBalancer,omitempty"`
+	MinReplicas       int      `json:"minReplicas,omitempty"`
+	ScaleUpThreshold  int      `json:"scaleUpThreshold,omitempty"`
+
+	TLS *UpstreamTLSDTO `json:"tls,omitempty"`
+
+	Owners []string          `json:"owners,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	Schedule *struct {
 		Days  []string `json:"days"`
 		Start string   `json:"start"`
 		Stop  string   `json:"stop"`
@@ -37,6 +52,8 @@ type CreateServiceRequest struct {
 type UpdateSystemRequest struct {
 	ListenAddr         *string `json:"listenAddr,omitempty"`
 	IdleReaperInterval *string `json:"idleReaperInterval,omitempty"`
+	LogLevel           *string `json:"logLevel,omitempty"`
+	LogFormat          *string `json:"logFormat,omitempty"`
 }
 
 type UpdateServiceRequest struct {
@@ -53,6 +70,17 @@ type UpdateServiceRequest struct {
 	StartupTimeout *string   `json:"startupTimeout,omitempty"`
 	Host           *string   `json:"host,omitempty"`
 	Enabled        *bool     `json:"enabled,omitempty"`
+
+	TargetURLs        *[]string `json:"targetUrls,omitempty"`
+	ReplicaContainers *[]string `json:"replicaContainers,omitempty"`
+	LoadBalancer      *string   `json:"loadBalancer,omitempty"`
+	MinReplicas       *int      `json:"minReplicas,omitempty"`
+	ScaleUpThreshold  *int      `json:"scaleUpThreshold,omitempty"`
+
+	TLS *UpstreamTLSDTO `json:"tls,omitempty"`
+
+	Owners *[]string          `json:"owners,omitempty"`
+	Labels *map[string]string `json:"labels,omitempty"`
 }
 
 const probeAllowWakeHeader = "X-Conslee-Probe-Allow-Wake"
@@ -60,34 +88,41 @@ const probeSignatureHeader = "X-Conslee-Service"
 
 // Probe types
 
+// ProbeRequest names a registered service; the server derives the URL.
+// Target is "proxy" (the public host through the front proxy, the default)
+// or "upstream" (the first service target, directly).
 type ProbeRequest struct {
-	URL        string `json:"url"`
-	ExpectHost string `json:"expectHost,omitempty"`
-	AllowWake  bool   `json:"allowWake"`
-	RequireSig bool   `json:"requireSignature"`
+	Service string `json:"service"`
+	Target  string `json:"target,omitempty"`
 }
 
 type ProbeResponse struct {
+	Service    string `json:"service"`
+	Target     string `json:"target"`
+	URL        string `json:"url"`
 	Status     string `json:"status"`
 	StatusCode int    `json:"statusCode,omitempty"`
 	FinalURL   string `json:"finalUrl,omitempty"`
+	LatencyMs  int64  `json:"latencyMs"`
+	Signature  bool   `json:"signature"` // X-Conslee-Service of this service was seen
 	Error      string `json:"error,omitempty"`
 }
 
 func (c *Conslee) serviceStatus(ctx context.Context, svc *ServiceState) (*ServiceStatusDTO, error) {
-	names := svc.Config.Containers
-	if len(names) == 0 && svc.Config.ContainerName != "" {
-		names = []string{svc.Config.ContainerName}
+	cfg := svc.Config()
+	names := cfg.Containers
+	if len(names) == 0 && cfg.ContainerName != "" {
+		names = []string{cfg.ContainerName}
 	}
 
 	running := false
-	for _, name := range names {
+	for _, name := range svc.ContainerNames() {
 		st, err := c.rt.Inspect(ctx, name)
 		if err != nil {
 			if errorsIsCtx(err) {
 				return nil, err
 			}
-			log.Printf("inspect %s error in serviceStatus: %v", name, err)
+			slog.Warn("inspect container", "service", cfg.Name, "container", name, "err", err)
 			continue
 		}
 		if st.Running {
@@ -97,25 +132,60 @@ func (c *Conslee) serviceStatus(ctx context.Context, svc *ServiceState) (*Servic
 	}
 
 	dto := &ServiceStatusDTO{
-		Name:           svc.Config.Name,
-		Host:           svc.Config.Host,
+		Name:           cfg.Name,
+		Host:           cfg.Host,
 		Containers:     names,
-		Mode:           svc.Config.Mode,
-		Enabled:        !svc.Config.Disabled,
+		Mode:           cfg.Mode,
+		Enabled:        !cfg.Disabled,
 		Running:        running,
 		LastActivity:   svc.LastActivity,
-		IdleTimeout:    svc.Config.IdleTimeout.String(),
-		StartupTimeout: svc.Config.StartupTimeout.String(),
-		TargetURL:      svc.Config.TargetURL,
-		HealthPath:     svc.Config.HealthPath,
+		IdleTimeout:    cfg.IdleTimeout.String(),
+		StartupTimeout: cfg.StartupTimeout.String(),
+		TargetURL:      cfg.TargetURL,
+		HealthPath:     cfg.HealthPath,
+
+		TargetURLs:        cfg.TargetURLs,
+		ReplicaContainers: cfg.ReplicaContainers,
+		LoadBalancer:      cfg.LoadBalancer,
+		MinReplicas:       cfg.MinReplicas,
+
+		Owners: cfg.Owners,
+		Labels: cfg.Labels,
+
+		SuppressedWakes: svc.SuppressedWakes(),
+	}
+
+	pool := svc.Pool()
+	if pool.Len() > 1 || len(pool.Replicas()) > 0 {
+		now := time.Now()
+		for _, u := range pool.All() {
+			dto.Upstreams = append(dto.Upstreams, UpstreamDTO{
+				URL:       u.Raw,
+				Container: u.Container,
+				Up:        u.IsUp(),
+				Ejected:   u.ejected(now),
+				Active:    u.Active(),
+			})
+		}
+	}
+
+	if tc := cfg.TLS; tc != nil {
+		dto.TLS = &UpstreamTLSDTO{
+			Verify:     tlsVerifyEnabled(tc),
+			CAFile:     tc.CAFile,
+			ServerName: tc.ServerName,
+			CertFile:   tc.CertFile,
+			KeyFile:    tc.KeyFile,
+		}
 	}
 
-	if svc.Config.Schedule != nil && svc.Schedule != nil {
+	sched := svc.Schedule()
+	if cfg.Schedule != nil && sched != nil {
 		dto.Schedule = &ServiceScheduleDTO{
-			Mode:  svc.Schedule.ModeString(),
-			Days:  svc.Config.Schedule.Days,
-			Start: svc.Config.Schedule.Start,
-			Stop:  svc.Config.Schedule.Stop,
+			Mode:  sched.ModeString(),
+			Days:  cfg.Schedule.Days,
+			Start: cfg.Schedule.Start,
+			Stop:  cfg.Schedule.Stop,
 		}
 	}
 
@@ -138,6 +208,22 @@ func extractServiceNameFromPath(path string, suffix string) string {
 	return strings.Trim(name, "/")
 }
 
+// authorizeService checks the caller against a service. Services the caller
+// cannot see are reported as not found.
+func authorizeService(w http.ResponseWriter, r *http.Request, svc *ServiceState, allowed func(*auth.Principal, config.ServiceConfig) bool) bool {
+	p := auth.FromContext(r.Context())
+	cfg := svc.Config()
+	if !p.CanView(*cfg) {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return false
+	}
+	if !allowed(p, *cfg) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 // Service handlers
 
 // GET /api/services
@@ -145,15 +231,24 @@ func (c *Conslee) HandleListServices(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	var out []*ServiceStatusDTO
 
+	p := auth.FromContext(ctx)
 	for _, svc := range c.reg.All() {
+		cfg := svc.Config()
+		if !p.CanView(*cfg) {
+			continue
+		}
 		status, err := c.serviceStatus(ctx, svc)
 		if err != nil {
 			if errorsIsCtx(err) {
 				return
 			}
-			log.Printf("serviceStatus error for %s: %v", svc.Config.Name, err)
+			slog.Warn("service status", "service", cfg.Name, "err", err)
 			continue
 		}
+		status.Permissions = &ServicePermissionsDTO{
+			Operate: p.CanOperate(*cfg),
+			Delete:  p.CanDelete(*cfg),
+		}
 		out = append(out, status)
 	}
 
@@ -174,13 +269,17 @@ func (c *Conslee) HandleStartService(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "service not found", http.StatusNotFound)
 		return
 	}
+	if !authorizeService(w, r, svc, (*auth.Principal).CanOperate) {
+		return
+	}
 
-	if err := ensureRunning(r.Context(), c.rt, svc); err != nil {
-		log.Printf("start service %s: %v", name, err)
+	if err := c.ensureRunning(r.Context(), svc, "started by "+actorOf(r)); err != nil {
+		slog.Error("start service", "service", name, "action", audit.ActionStart, "err", err)
 		http.Error(w, "cannot start service", http.StatusInternalServerError)
 		return
 	}
 	svc.LastActivity = time.Now()
+	c.record(r, audit.ActionStart, name, nil)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -197,33 +296,38 @@ func (c *Conslee) HandleStopService(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "service not found", http.StatusNotFound)
 		return
 	}
+	if !authorizeService(w, r, svc, (*auth.Principal).CanOperate) {
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
 	c.stopServiceContainers(ctx, svc)
+	c.record(r, audit.ActionStop, name, nil)
 
 	if err := c.saveConfig(); err != nil {
-		log.Printf("save config error for %s: %v", svc.Config.Name, err)
+		slog.Error("save config", "service", svc.Config().Name, "action", audit.ActionStop, "err", err)
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (c *Conslee) stopServiceContainers(ctx context.Context, svc *ServiceState) {
-	names := append([]string(nil), svc.Config.Containers...)
-	if len(names) == 0 && svc.Config.ContainerName != "" {
-		names = []string{svc.Config.ContainerName}
-	}
-	for _, n := range names {
+	for _, n := range svc.ContainerNames() {
 		if err := c.rt.Stop(ctx, n, 0); err != nil {
-			log.Printf("stop %s error: %v", n, err)
+			slog.Error("stop container", "service", svc.Config().Name, "container", n, "action", audit.ActionStop, "err", err)
 		}
 	}
 }
 
 // POST /api/services
 func (c *Conslee) HandleCreateService(w http.ResponseWriter, r *http.Request) {
+	if !auth.IsJSON(r) {
+		http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
 	var req CreateServiceRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
@@ -264,7 +368,12 @@ func (c *Conslee) HandleCreateService(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if svcName, containerName := c.reg.FindContainerConflict(req.Containers, ""); svcName != "" {
+	if !ValidLoadBalancer(req.LoadBalancer) {
+		http.Error(w, "invalid loadBalancer", http.StatusBadRequest)
+		return
+	}
+
+	if svcName, containerName := c.reg.FindContainerConflict(append(append([]string(nil), req.Containers...), req.ReplicaContainers...), ""); svcName != "" {
 		http.Error(
 			w,
 			fmt.Sprintf("container %q already used by service %q", containerName, svcName),
@@ -288,16 +397,6 @@ func (c *Conslee) HandleCreateService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var parsedTarget *url.URL
-	if req.TargetURL != "" {
-		u, err := url.Parse(req.TargetURL)
-		if err != nil {
-			http.Error(w, "invalid targetUrl", http.StatusBadRequest)
-			return
-		}
-		parsedTarget = u
-	}
-
 	cfgSvc := config.ServiceConfig{
 		Name:              req.Name,
 		Host:              host,
@@ -309,6 +408,20 @@ func (c *Conslee) HandleCreateService(w http.ResponseWriter, r *http.Request) {
 		RawStartupTimeout: req.StartupTimeout,
 		StartupTimeout:    startup,
 		HealthPath:        req.HealthPath,
+		TargetURLs:        req.TargetURLs,
+		ReplicaContainers: req.ReplicaContainers,
+		LoadBalancer:      req.LoadBalancer,
+		MinReplicas:       req.MinReplicas,
+		ScaleUpThreshold:  req.ScaleUpThreshold,
+		TLS:               req.TLS.toConfig(),
+		Owners:            req.Owners,
+		Labels:            req.Labels,
+	}
+
+	pool, err := NewUpstreamPool(cfgSvc)
+	if err != nil {
+		http.Error(w, upstreamSettingsError(cfgSvc.Name, err), http.StatusBadRequest)
+		return
 	}
 
 	if req.Schedule != nil {
@@ -319,16 +432,13 @@ func (c *Conslee) HandleCreateService(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	st := &ServiceState{
-		Config:       cfgSvc,
-		Target:       parsedTarget,
-		LastActivity: time.Now(),
-		Schedule:     ParseSchedule(cfgSvc.Schedule, cfgSvc.Mode),
-	}
-	c.reg.Add(cfgSvc.Host, st)
+	warnUnverifiedTLS(cfgSvc, pool)
+	c.reg.Add(cfgSvc.Host, newServiceState(cfgSvc, pool))
+	c.record(r, audit.ActionCreate, cfgSvc.Name, audit.Diff(nil, cfgSvc))
+	c.publish(events.TypeConfigChanged, cfgSvc.Name, audit.ActionCreate)
 
 	if err := c.saveConfig(); err != nil {
-		log.Printf("save config after create service error: %v", err)
+		slog.Error("save config", "service", cfgSvc.Name, "action", audit.ActionCreate, "err", err)
 	}
 
 	w.WriteHeader(http.StatusCreated)
@@ -342,15 +452,23 @@ func (c *Conslee) HandleDeleteService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, ok := c.reg.GetByName(name); !ok {
+	svc, ok := c.reg.GetByName(name)
+	if !ok {
 		http.Error(w, "service not found", http.StatusNotFound)
 		return
 	}
+	if !authorizeService(w, r, svc, (*auth.Principal).CanDelete) {
+		return
+	}
 
 	c.reg.DelByName(name)
+	svc.Pool().Close()
+	c.record(r, audit.ActionDelete, name, audit.Diff(svc.Config(), nil))
+	c.publish(events.TypeConfigChanged, name, audit.ActionDelete)
+	forgetServiceMetrics(name)
 
 	if err := c.saveConfig(); err != nil {
-		log.Printf("save config after delete service error: %v", err)
+		slog.Error("save config", "service", name, "action", audit.ActionDelete, "err", err)
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -369,6 +487,13 @@ func (c *Conslee) HandleUpdateService(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "service not found", http.StatusNotFound)
 		return
 	}
+	if !authorizeService(w, r, svc, (*auth.Principal).CanOperate) {
+		return
+	}
+	if !auth.IsJSON(r) {
+		http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
 
 	var req UpdateServiceRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -376,16 +501,95 @@ func (c *Conslee) HandleUpdateService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	desiredMode := svc.Config.Mode
-	modeChanged := false
+	if (req.Owners != nil || req.Labels != nil) && !auth.FromContext(r.Context()).HasRole(auth.RoleAdmin) {
+		http.Error(w, "only admins can change owners and labels", http.StatusForbidden)
+		return
+	}
+	// The files are read with the permissions of Conslee.
+	if req.TLS.hasFiles() && !auth.FromContext(r.Context()).HasRole(auth.RoleAdmin) {
+		http.Error(w, "only admins can set TLS files", http.StatusForbidden)
+		return
+	}
+
+	// The new settings are built and checked in full before any of them
+	// applies, so a rejected request changes nothing.
+	var before map[string]any
+	var after *config.ServiceConfig
+	var oldHost string
+	var wasDisabled, targetsChanged bool
+	err := svc.update(func(cfg *config.ServiceConfig) error {
+		before = audit.Snapshot(cfg)
+		oldHost, wasDisabled = cfg.Host, cfg.Disabled
+		after = cfg
+		return applyServiceUpdate(c.reg, svc, cfg, &req, &targetsChanged)
+	}, func(cfg config.ServiceConfig) (*UpstreamPool, error) {
+		if !targetsChanged {
+			return nil, nil
+		}
+		pool, err := NewUpstreamPool(cfg)
+		if err != nil {
+			return nil, &requestError{http.StatusBadRequest, upstreamSettingsError(cfg.Name, err)}
+		}
+		warnUnverifiedTLS(cfg, pool)
+		return pool, nil
+	})
+	if err != nil {
+		var re *requestError
+		if errors.As(err, &re) {
+			http.Error(w, re.msg, re.status)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if after.Host != oldHost {
+		c.reg.UpdateHost(svc, oldHost)
+	}
+	if wasDisabled && !after.Disabled {
+		svc.LastActivity = time.Now()
+	}
+
+	if changes := audit.Diff(before, after); len(changes) > 0 {
+		c.record(r, audit.ActionUpdate, name, changes)
+		c.publish(events.TypeConfigChanged, name, audit.ActionUpdate)
+	}
+
+	if err := c.saveConfig(); err != nil {
+		slog.Error("save config", "service", svc.Config().Name, "action", audit.ActionUpdate, "err", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// upstreamSettingsError is the message for upstream settings that cannot
+// be used. Errors about TLS files are only logged.
+func upstreamSettingsError(service string, err error) string {
+	var fe *tlsFileError
+	if errors.As(err, &fe) {
+		slog.Warn("invalid upstream TLS files", "service", service, "err", err)
+		return "invalid upstream TLS files; see the server log"
+	}
+	return fmt.Sprintf("invalid upstream settings: %v", err)
+}
+
+// requestError rejects a request with an HTTP status.
+type requestError struct {
+	status int
+	msg    string
+}
+
+func (e *requestError) Error() string { return e.msg }
+
+// applyServiceUpdate applies req to cfg, a copy of the settings of svc. It
+// sets *targetsChanged when the upstream pool has to be rebuilt.
+func applyServiceUpdate(reg *ServiceRegistry, svc *ServiceState, cfg *config.ServiceConfig, req *UpdateServiceRequest, targetsChanged *bool) error {
+	desiredMode := cfg.Mode
 	if req.Mode != nil && *req.Mode != "" {
 		switch *req.Mode {
 		case "on_demand", "schedule_only", "both":
 			desiredMode = *req.Mode
-			modeChanged = true
 		default:
-			http.Error(w, "invalid mode", http.StatusBadRequest)
-			return
+			return &requestError{http.StatusBadRequest, "invalid mode"}
 		}
 	}
 
@@ -393,60 +597,38 @@ func (c *Conslee) HandleUpdateService(w http.ResponseWriter, r *http.Request) {
 	if req.Host != nil {
 		newHost := strings.TrimSpace(*req.Host)
 		if desiredMode != "schedule_only" && newHost == "" {
-			http.Error(w, "host is required unless mode is schedule_only", http.StatusBadRequest)
-			return
+			return &requestError{http.StatusBadRequest, "host is required unless mode is schedule_only"}
 		}
-		if newHost != svc.Config.Host {
-			if newHost != "" {
-				if other, ok := c.reg.GetByHost(newHost); ok && other != svc {
-					http.Error(w, "host already used", http.StatusConflict)
-					return
-				}
+		if newHost != cfg.Host && newHost != "" {
+			if other, ok := reg.GetByHost(newHost); ok && other != svc {
+				return &requestError{http.StatusConflict, "host already used"}
 			}
-			c.reg.UpdateHost(svc, newHost)
 		}
+		cfg.Host = newHost
 	}
 
 	if req.Enabled != nil {
-		previouslyDisabled := svc.Config.Disabled
-		svc.Config.Disabled = !*req.Enabled
-		if !svc.Config.Disabled && previouslyDisabled {
-			svc.LastActivity = time.Now()
-		}
-	}
-
-	if modeChanged {
-		svc.Config.Mode = desiredMode
-		if svc.Schedule != nil {
-			switch desiredMode {
-			case "schedule_only":
-				svc.Schedule.Mode = ModeScheduleOnly
-			case "both":
-				svc.Schedule.Mode = ModeBoth
-			default:
-				svc.Schedule.Mode = ModeOnDemand
-			}
-		}
+		cfg.Disabled = !*req.Enabled
 	}
+	cfg.Mode = desiredMode
 
 	// IDLE TIMEOUT
 	if req.IdleTimeout != nil && *req.IdleTimeout != "" {
 		d, err := time.ParseDuration(*req.IdleTimeout)
 		if err != nil {
-			http.Error(w, "invalid idleTimeout", http.StatusBadRequest)
-			return
+			return &requestError{http.StatusBadRequest, "invalid idleTimeout"}
 		}
-		svc.Config.IdleTimeout = d
-		svc.Config.RawIdleTimeout = *req.IdleTimeout
+		cfg.IdleTimeout = d
+		cfg.RawIdleTimeout = *req.IdleTimeout
 	}
 
 	// SCHEDULE
 	if req.Schedule != nil {
-		if svc.Config.Schedule == nil {
-			svc.Config.Schedule = &config.ScheduleConfig{}
+		// The schedule is shared with the current settings; change a copy.
+		sc := &config.ScheduleConfig{}
+		if cfg.Schedule != nil {
+			*sc = *cfg.Schedule
 		}
-		sc := svc.Config.Schedule
-
 		if req.Schedule.Days != nil {
 			sc.Days = *req.Schedule.Days
 		}
@@ -456,58 +638,79 @@ func (c *Conslee) HandleUpdateService(w http.ResponseWriter, r *http.Request) {
 		if req.Schedule.Stop != nil {
 			sc.Stop = *req.Schedule.Stop
 		}
-
-		svc.Schedule = ParseSchedule(sc, svc.Config.Mode)
+		cfg.Schedule = sc
 	}
 
 	// CONTAINERS
 	if req.Containers != nil {
-		newContainers := *req.Containers
-
-		if svcName, containerName := c.reg.FindContainerConflict(newContainers, svc.Config.Name); svcName != "" {
-			http.Error(
-				w,
-				fmt.Sprintf("container %q already used by service %q", containerName, svcName),
-				http.StatusConflict,
-			)
-			return
+		if svcName, containerName := reg.FindContainerConflict(*req.Containers, cfg.Name); svcName != "" {
+			return &requestError{http.StatusConflict, fmt.Sprintf("container %q already used by service %q", containerName, svcName)}
 		}
-
-		svc.Config.Containers = newContainers
+		cfg.Containers = *req.Containers
 	}
 
-	// TARGET URL
+	// TARGETS
 	if req.TargetURL != nil && *req.TargetURL != "" {
-		u, err := url.Parse(*req.TargetURL)
-		if err != nil {
-			http.Error(w, "invalid targetUrl", http.StatusBadRequest)
-			return
+		if _, _, err := parseTarget(*req.TargetURL); err != nil {
+			return &requestError{http.StatusBadRequest, "invalid targetUrl"}
+		}
+		cfg.TargetURL = *req.TargetURL
+		*targetsChanged = true
+	}
+	if req.TargetURLs != nil {
+		cfg.TargetURLs = *req.TargetURLs
+		*targetsChanged = true
+	}
+	if req.ReplicaContainers != nil {
+		if svcName, containerName := reg.FindContainerConflict(*req.ReplicaContainers, cfg.Name); svcName != "" {
+			return &requestError{http.StatusConflict, fmt.Sprintf("container %q already used by service %q", containerName, svcName)}
+		}
+		cfg.ReplicaContainers = *req.ReplicaContainers
+		*targetsChanged = true
+	}
+	if req.LoadBalancer != nil {
+		if !ValidLoadBalancer(*req.LoadBalancer) {
+			return &requestError{http.StatusBadRequest, "invalid loadBalancer"}
 		}
-		svc.Config.TargetURL = *req.TargetURL
-		svc.Target = u
+		cfg.LoadBalancer = *req.LoadBalancer
+		*targetsChanged = true
+	}
+	if req.TLS != nil {
+		cfg.TLS = req.TLS.toConfig()
+		*targetsChanged = true
+	}
+
+	// REPLICA SCALING
+	if req.MinReplicas != nil {
+		cfg.MinReplicas = *req.MinReplicas
+	}
+	if req.ScaleUpThreshold != nil {
+		cfg.ScaleUpThreshold = *req.ScaleUpThreshold
+	}
+
+	// ACCESS
+	if req.Owners != nil {
+		cfg.Owners = *req.Owners
+	}
+	if req.Labels != nil {
+		cfg.Labels = *req.Labels
 	}
 
 	// HEALTH PATH
 	if req.HealthPath != nil {
-		svc.Config.HealthPath = *req.HealthPath
+		cfg.HealthPath = *req.HealthPath
 	}
 
 	// STARTUP TIMEOUT
 	if req.StartupTimeout != nil && *req.StartupTimeout != "" {
 		d, err := time.ParseDuration(*req.StartupTimeout)
 		if err != nil {
-			http.Error(w, "invalid startupTimeout", http.StatusBadRequest)
-			return
+			return &requestError{http.StatusBadRequest, "invalid startupTimeout"}
 		}
-		svc.Config.StartupTimeout = d
-		svc.Config.RawStartupTimeout = *req.StartupTimeout
-	}
-
-	if err := c.saveConfig(); err != nil {
-		log.Printf("save config error for %s: %v", svc.Config.Name, err)
+		cfg.StartupTimeout = d
+		cfg.RawStartupTimeout = *req.StartupTimeout
 	}
-
-	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
 
 // System handlers
@@ -519,9 +722,21 @@ func (c *Conslee) HandleGetSystem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	c.configMu.Lock()
+	sys := c.systemSettings()
+	c.configMu.Unlock()
+
 	dto := &SystemStatusDTO{
-		ListenAddr:         c.cfg.Server.ListenAddr,
-		IdleReaperInterval: c.cfg.IdleReaper.Interval.String(),
+		ListenAddr:         sys.Server.ListenAddr,
+		IdleReaperInterval: sys.IdleReaper.Interval.String(),
+		LogLevel:           sys.Log.Level,
+		LogFormat:          sys.Log.Format,
+	}
+	if dto.LogLevel == "" {
+		dto.LogLevel = "info"
+	}
+	if dto.LogFormat == "" {
+		dto.LogFormat = logging.FormatText
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -530,19 +745,40 @@ func (c *Conslee) HandleGetSystem(w http.ResponseWriter, r *http.Request) {
 
 // POST /api/probes
 func (c *Conslee) HandleProbe(w http.ResponseWriter, r *http.Request) {
+	if !auth.IsJSON(r) {
+		http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
 	var req ProbeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	req.URL = strings.TrimSpace(req.URL)
-	if req.URL == "" {
-		http.Error(w, "url is required", http.StatusBadRequest)
+	if ok, wait := allow(c.probeLimits.clientLimiter(probeCaller(r), &probeRateLimit)); !ok {
+		tooManyRequests(w, wait, "too many probes")
 		return
 	}
 
-	result := performProbe(r.Context(), &req)
+	svc, ok := c.reg.GetByName(strings.TrimSpace(req.Service))
+	if !ok {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+	if !authorizeService(w, r, svc, (*auth.Principal).CanView) {
+		return
+	}
+
+	target, err := probeTargetFor(r, svc, req.Target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := performProbe(r.Context(), target)
+	result.Service = svc.Config().Name
+	result.Target = target.kind
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(result)
@@ -550,73 +786,145 @@ func (c *Conslee) HandleProbe(w http.ResponseWriter, r *http.Request) {
 
 // Probe functions
 
-func performProbe(ctx context.Context, req *ProbeRequest) *ProbeResponse {
-	client := &http.Client{
-		Timeout: 5 * time.Second,
+const probeTimeout = 5 * time.Second
+
+// probeRateLimit applies per caller; the UI probes each service twice
+// every 10 seconds.
+var probeRateLimit = config.RateLimitConfig{
+	PerClientRequestsPerSecond: 10,
+	PerClientBurst:             60,
+}
+
+// probeCaller identifies the caller for rate limiting: the signed-in user or
+// token, or the client address when authentication is disabled.
+func probeCaller(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil && p.Method != auth.MethodNone {
+		return "user:" + p.Name
 	}
+	return "ip:" + getClientIP(r)
+}
+
+type probeTarget struct {
+	kind       string
+	service    string
+	url        string
+	expectHost string
+	allowWake  bool
+	requireSig bool
+	client     *http.Client
+}
 
-	headResult, headErr := doProbeRequest(ctx, client, http.MethodHead, req)
+// probeTargetFor computes what to probe for a service. Redirects are only
+// followed within the expected host.
+func probeTargetFor(r *http.Request, svc *ServiceState, kind string) (*probeTarget, error) {
+	cfg := svc.Config()
+	healthPath := strings.TrimSpace(cfg.HealthPath)
+	if healthPath == "" {
+		healthPath = "/"
+	} else if !strings.HasPrefix(healthPath, "/") {
+		healthPath = "/" + healthPath
+	}
+
+	t := &probeTarget{kind: kind, service: cfg.Name}
+	var client *http.Client
+	switch kind {
+	case "", "proxy":
+		host := strings.TrimSpace(cfg.Host)
+		if host == "" {
+			return nil, errors.New("service has no host")
+		}
+		t.kind = "proxy"
+		t.url = requestScheme(r) + "://" + host + healthPath
+		t.expectHost = strings.ToLower(host)
+		t.requireSig = true
+		client = &http.Client{Timeout: probeTimeout}
+	case "upstream":
+		pool := svc.Pool()
+		ups := pool.All()
+		if len(ups) == 0 {
+			return nil, errors.New("service has no target")
+		}
+		u := *ups[0].URL
+		u.Path = healthPath
+		u.RawQuery = ""
+		t.url = u.String()
+		t.expectHost = strings.ToLower(u.Host)
+		t.allowWake = true
+		client = pool.client(probeTimeout)
+	default:
+		return nil, fmt.Errorf("invalid target %q", kind)
+	}
+
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 || !strings.EqualFold(req.URL.Host, t.expectHost) {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+	t.client = client
+	return t, nil
+}
+
+func performProbe(ctx context.Context, t *probeTarget) *ProbeResponse {
+	headResult, headErr := doProbeRequest(ctx, http.MethodHead, t)
 	if headErr == nil && headResult.Status == "healthy" {
 		return headResult
 	}
 
-	getResult, getErr := doProbeRequest(ctx, client, http.MethodGet, req)
+	getResult, getErr := doProbeRequest(ctx, http.MethodGet, t)
 	if getErr != nil {
+		result := &ProbeResponse{URL: t.url, Status: "unhealthy", Error: getErr.Error()}
 		if headErr != nil {
-			return &ProbeResponse{
-				Status: "unhealthy",
-				Error:  headErr.Error(),
-			}
-		}
-		return &ProbeResponse{
-			Status: "unhealthy",
-			Error:  getErr.Error(),
+			result.Error = headErr.Error()
 		}
+		return result
 	}
 
 	return getResult
 }
 
-func doProbeRequest(ctx context.Context, client *http.Client, method string, req *ProbeRequest) (*ProbeResponse, error) {
-	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, nil)
+func doProbeRequest(ctx context.Context, method string, t *probeTarget) (*ProbeResponse, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, t.url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	if !req.AllowWake {
+	if !t.allowWake {
 		httpReq.Header.Set(probeAllowWakeHeader, "false")
 	}
 
-	resp, err := client.Do(httpReq)
+	start := time.Now()
+	resp, err := t.client.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
+	latency := time.Since(start)
 	defer resp.Body.Close()
-	_, _ = io.Copy(io.Discard, resp.Body)
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
 
 	result := &ProbeResponse{
+		URL:        t.url,
 		StatusCode: resp.StatusCode,
 		Status:     "unhealthy",
+		LatencyMs:  latency.Milliseconds(),
+		Signature:  resp.Header.Get(probeSignatureHeader) == t.service,
 	}
 
 	if resp.Request != nil && resp.Request.URL != nil {
 		result.FinalURL = resp.Request.URL.String()
 	}
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		if req.RequireSig {
-			if resp.Header.Get(probeSignatureHeader) == "" {
-				result.Error = "missing conslee signature"
-				return result, nil
-			}
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if loc, err := resp.Location(); err == nil && !strings.EqualFold(loc.Host, t.expectHost) {
+			result.Error = fmt.Sprintf("redirected to %s", strings.ToLower(loc.Host))
+			return result, nil
 		}
-		if req.ExpectHost != "" && resp.Request != nil && resp.Request.URL != nil {
-			expectedHost := strings.ToLower(req.ExpectHost)
-			actualHost := strings.ToLower(resp.Request.URL.Host)
-			if actualHost != expectedHost {
-				result.Error = fmt.Sprintf("redirected to %s", actualHost)
-				return result, nil
-			}
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+		if t.requireSig && !result.Signature {
+			result.Error = "missing conslee signature"
+			return result, nil
 		}
 		result.Status = "healthy"
 		return result, nil
@@ -643,7 +951,13 @@ func (c *Conslee) HandleCheckPort(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if c.cfg != nil && listenAddr == c.cfg.Server.ListenAddr {
+	current := ""
+	if c.cfg != nil {
+		c.configMu.Lock()
+		current = c.cfg.Server.ListenAddr
+		c.configMu.Unlock()
+	}
+	if listenAddr == current {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -671,6 +985,12 @@ func (c *Conslee) HandleCheckPort(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// systemSettings are the parts of the config changed through POST /api/system.
+// c.configMu must be held.
+func (c *Conslee) systemSettings() config.Config {
+	return config.Config{Server: c.cfg.Server, IdleReaper: c.cfg.IdleReaper, Log: c.cfg.Log}
+}
+
 // POST /api/system
 func (c *Conslee) HandleUpdateSystem(w http.ResponseWriter, r *http.Request) {
 	if c.cfg == nil {
@@ -678,37 +998,77 @@ func (c *Conslee) HandleUpdateSystem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !auth.IsJSON(r) {
+		http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
 	var req UpdateSystemRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
-
-	portChanged := false
+	// Validate everything first, so a bad field changes nothing.
+	listenAddr := ""
 	if req.ListenAddr != nil && *req.ListenAddr != "" {
-		// Validate format
-		if !strings.HasPrefix(*req.ListenAddr, ":") && !strings.Contains(*req.ListenAddr, ":") {
+		listenAddr = *req.ListenAddr
+		if !strings.HasPrefix(listenAddr, ":") && !strings.Contains(listenAddr, ":") {
 			http.Error(w, "invalid listenAddr format", http.StatusBadRequest)
 			return
 		}
-		if c.cfg.Server.ListenAddr != *req.ListenAddr {
-			portChanged = true
-			c.cfg.Server.ListenAddr = *req.ListenAddr
-		}
 	}
-
+	var interval time.Duration
 	if req.IdleReaperInterval != nil && *req.IdleReaperInterval != "" {
 		d, err := time.ParseDuration(*req.IdleReaperInterval)
 		if err != nil {
 			http.Error(w, "invalid idleReaperInterval", http.StatusBadRequest)
 			return
 		}
+		interval = d
+	}
+	if req.LogLevel != nil {
+		if _, err := logging.ParseLevel(*req.LogLevel); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.LogFormat != nil && !config.ValidLogFormat(*req.LogFormat) {
+		http.Error(w, fmt.Sprintf("invalid log format %q", *req.LogFormat), http.StatusBadRequest)
+		return
+	}
+
+	c.configMu.Lock()
+	before := audit.Snapshot(c.systemSettings())
+	portChanged := listenAddr != "" && listenAddr != c.cfg.Server.ListenAddr
+	if portChanged {
+		c.cfg.Server.ListenAddr = listenAddr
+	}
+	if req.IdleReaperInterval != nil && *req.IdleReaperInterval != "" {
 		c.cfg.IdleReaper.RawInterval = *req.IdleReaperInterval
-		c.cfg.IdleReaper.Interval = d
+		c.cfg.IdleReaper.Interval = interval
+	}
+	// Log settings apply immediately, without a restart.
+	if req.LogLevel != nil || req.LogFormat != nil {
+		if req.LogLevel != nil {
+			c.cfg.Log.Level = *req.LogLevel
+		}
+		if req.LogFormat != nil {
+			c.cfg.Log.Format = *req.LogFormat
+		}
+		if err := logging.Apply(c.cfg.Log); err != nil {
+			slog.Error("apply log settings", "action", audit.ActionSystemUpdate, "err", err)
+		}
+	}
+	changes := audit.Diff(before, c.systemSettings())
+	c.configMu.Unlock()
+
+	if len(changes) > 0 {
+		c.record(r, audit.ActionSystemUpdate, "", changes)
+		c.publish(events.TypeConfigChanged, "", audit.ActionSystemUpdate)
 	}
 
 	if err := c.saveConfig(); err != nil {
-		log.Printf("save system config error: %v", err)
+		slog.Error("save config", "action", audit.ActionSystemUpdate, "err", err)
 		http.Error(w, "failed to save config", http.StatusInternalServerError)
 		return
 	}
@@ -718,7 +1078,7 @@ func (c *Conslee) HandleUpdateSystem(w http.ResponseWriter, r *http.Request) {
 		go func() {
 			time.Sleep(500 * time.Millisecond) // Give time for response to be sent
 			if err := c.RequestRestart(); err != nil {
-				log.Printf("failed to request restart: %v", err)
+				slog.Error("request restart", "err", err)
 			}
 		}()
 	}
@@ -734,7 +1094,7 @@ func (c *Conslee) HandleListContainers(w http.ResponseWriter, r *http.Request) {
 	list, err := c.rt.List(ctx, true)
 	if err != nil {
 		http.Error(w, "docker error", http.StatusInternalServerError)
-		log.Printf("ContainerList error: %v", err)
+		slog.Error("list containers", "err", err)
 		return
 	}
 
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"conslee/internal/auth"
+)
+
+// Container logs
+
+const (
+	// startupLogLines is how many lines of each container are logged after
+	// a failed start.
+	startupLogLines = 20
+	tailLogsTimeout = 5 * time.Second
+	// maxLogLine bounds the length of captured lines.
+	maxLogLine = 500
+
+	defaultLogTail = 200
+	maxLogTail     = 10000
+)
+
+// tailLogs returns the last lines of each container of the service, under
+// a "==> name <==" header when there are several.
+func (c *Conslee) tailLogs(svc *ServiceState, lines int) string {
+	ctx, cancel := context.WithTimeout(context.Background(), tailLogsTimeout)
+	defer cancel()
+
+	names := svc.ContainerNames()
+	var b strings.Builder
+	for _, name := range names {
+		rc, err := c.rt.Logs(ctx, name, LogOptions{Tail: lines})
+		if err != nil {
+			slog.Warn("read container logs", "service", svc.Config().Name, "container", name, "err", err)
+			continue
+		}
+		var out []string
+		sc := bufio.NewScanner(rc)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		for sc.Scan() {
+			line := sc.Text()
+			if len(line) > maxLogLine {
+				line = line[:maxLogLine] + "…"
+			}
+			out = append(out, line)
+		}
+		_ = rc.Close()
+		if len(out) == 0 {
+			continue
+		}
+		if len(names) > 1 {
+			b.WriteString("==> " + name + " <==\n")
+		}
+		b.WriteString(strings.Join(out, "\n"))
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// GET /api/services/{name}/logs?container=&since=&tail=&follow=&timestamps=
+//
+// Streams the output of one container of the service as plain text. since
+// is an RFC 3339 time or a duration before now; without it the last tail
+// lines are returned.
+func (c *Conslee) HandleServiceLogs(w http.ResponseWriter, r *http.Request) {
+	name := extractServiceNameFromPath(r.URL.Path, "/logs")
+	if name == "" {
+		http.Error(w, "service name required", http.StatusBadRequest)
+		return
+	}
+
+	svc, ok := c.reg.GetByName(name)
+	if !ok {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+	// Logs may contain secrets, so viewing the service is not enough.
+	if !authorizeService(w, r, svc, (*auth.Principal).CanOperate) {
+		return
+	}
+
+	q := r.URL.Query()
+	names := svc.ContainerNames()
+	ctr := q.Get("container")
+	if ctr == "" {
+		if len(names) == 0 {
+			http.Error(w, "service has no containers", http.StatusBadRequest)
+			return
+		}
+		ctr = names[0]
+	} else if !slices.Contains(names, ctr) {
+		http.Error(w, "container does not belong to the service", http.StatusBadRequest)
+		return
+	}
+
+	var opts LogOptions
+	if v := q.Get("since"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			opts.Since = t
+		} else if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			opts.Since = time.Now().Add(-d)
+		} else {
+			http.Error(w, "invalid since, expected RFC 3339 or a duration such as 15m", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("tail"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxLogTail {
+			http.Error(w, "invalid tail, expected 0 to "+strconv.Itoa(maxLogTail), http.StatusBadRequest)
+			return
+		}
+		opts.Tail = n
+	} else if opts.Since.IsZero() {
+		opts.Tail = defaultLogTail
+	}
+	for _, f := range []struct {
+		name string
+		dst  *bool
+	}{{"follow", &opts.Follow}, {"timestamps", &opts.Timestamps}} {
+		if v := q.Get(f.name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "invalid "+f.name+", expected true or false", http.StatusBadRequest)
+				return
+			}
+			*f.dst = b
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if opts.Follow {
+		// Streams outlive the server's write timeout, and end on shutdown
+		// like the event stream.
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		go func() {
+			select {
+			case <-c.events.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	logs, err := c.rt.Logs(ctx, ctr, opts)
+	if err != nil {
+		slog.Error("read container logs", "service", name, "container", ctr, "err", err)
+		http.Error(w, "cannot read container logs", http.StatusBadGateway)
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := logs.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if opts.Follow {
+				if ferr := rc.Flush(); ferr != nil {
+					return
+				}
+			}
+		}
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				slog.Warn("stream container logs", "service", name, "container", ctr, "err", err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Prometheus metrics
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "conslee_requests_total",
+		Help: "Proxied requests by service, method and status code.",
+	}, []string{"service", "method", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "conslee_request_duration_seconds",
+		Help:    "Time to serve proxied requests, including waking the service.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"service"})
+
+	wakesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "conslee_wakes_total",
+		Help: "Times a service had stopped containers started.",
+	}, []string{"service"})
+
+	ensureRunningDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "conslee_ensure_running_duration_seconds",
+		Help:    "Time to start a stopped service until it was ready.",
+		Buckets: []float64{.25, .5, 1, 2, 5, 10, 20, 30, 60, 120},
+	}, []string{"service"})
+
+	ensureRunningFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "conslee_ensure_running_failures_total",
+		Help: "Failed attempts to start a service or wait for it to become ready.",
+	}, []string{"service"})
+
+	idleStopsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "conslee_idle_stops_total",
+		Help: "Times a service was stopped by the idle reaper.",
+	}, []string{"service"})
+
+	scheduleActionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "conslee_schedule_actions_total",
+		Help: "Services started or stopped by their schedule.",
+	}, []string{"service", "action"})
+
+	dockerErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "conslee_docker_errors_total",
+		Help: "Failed Docker API calls by operation.",
+	}, []string{"op"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		wakesTotal,
+		ensureRunningDuration,
+		ensureRunningFailures,
+		idleStopsTotal,
+		scheduleActionsTotal,
+		dockerErrorsTotal,
+	)
+}
+
+// MetricsHandler serves the metrics in the Prometheus text format.
+func (c *Conslee) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// forgetServiceMetrics drops the series of a deleted service.
+func forgetServiceMetrics(name string) {
+	for _, v := range []interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{requestsTotal, requestDuration, wakesTotal, ensureRunningDuration, ensureRunningFailures, idleStopsTotal, scheduleActionsTotal} {
+		v.DeletePartialMatch(prometheus.Labels{"service": name})
+	}
+}
+
+// runningCollector reports whether each service is running when scraped.
+type runningCollector struct {
+	c    *Conslee
+	desc *prometheus.Desc
+}
+
+func newRunningCollector(c *Conslee) *runningCollector {
+	return &runningCollector{
+		c: c,
+		desc: prometheus.NewDesc("conslee_service_running",
+			"Whether the containers of a service are running (1) or not (0).",
+			[]string{"service"}, nil),
+	}
+}
+
+func (rc *runningCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rc.desc
+}
+
+func (rc *runningCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, svc := range rc.c.reg.All() {
+		running, err := isRunning(ctx, rc.c.rt, svc)
+		if err != nil {
+			continue
+		}
+		v := 0.0
+		if running {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(rc.desc, prometheus.GaugeValue, v, svc.Config().Name)
+	}
+}
+
+// instrumentedRuntime counts failed Docker API calls and traces them.
+type instrumentedRuntime struct {
+	ContainerRuntime
+}
+
+func countDockerError(op string, err error) error {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		dockerErrorsTotal.WithLabelValues(op).Inc()
+	}
+	return err
+}
+
+func (r instrumentedRuntime) Inspect(ctx context.Context, name string) (ContainerState, error) {
+	ctx, span := startSpan(ctx, "docker.inspect", attribute.String("conslee.container", name))
+	st, err := r.ContainerRuntime.Inspect(ctx, name)
+	span.SetAttributes(attribute.Bool("conslee.running", st.Running))
+	endSpan(span, err)
+	return st, countDockerError("inspect", err)
+}
+
+func (r instrumentedRuntime) Start(ctx context.Context, name string) error {
+	ctx, span := startSpan(ctx, "docker.start", attribute.String("conslee.container", name))
+	err := r.ContainerRuntime.Start(ctx, name)
+	endSpan(span, err)
+	return countDockerError("start", err)
+}
+
+func (r instrumentedRuntime) Stop(ctx context.Context, name string, timeout time.Duration) error {
+	ctx, span := startSpan(ctx, "docker.stop", attribute.String("conslee.container", name))
+	err := r.ContainerRuntime.Stop(ctx, name, timeout)
+	endSpan(span, err)
+	return countDockerError("stop", err)
+}
+
+func (r instrumentedRuntime) Stats(ctx context.Context, name string) (ContainerStats, error) {
+	st, err := r.ContainerRuntime.Stats(ctx, name)
+	return st, countDockerError("stats", err)
+}
+
+func (r instrumentedRuntime) Logs(ctx context.Context, name string, opts LogOptions) (io.ReadCloser, error) {
+	rc, err := r.ContainerRuntime.Logs(ctx, name, opts)
+	return rc, countDockerError("logs", err)
+}
+
+func (r instrumentedRuntime) List(ctx context.Context, all bool) ([]ContainerInfo, error) {
+	list, err := r.ContainerRuntime.List(ctx, all)
+	return list, countDockerError("list", err)
+}
+
+// statusRecorder captures the status code and size of a response. Unwrap
+// keeps flushing and connection upgrades working through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	_ = http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *statusRecorder) code() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+// metricMethod keeps arbitrary client methods out of the label values.
+func metricMethod(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return m
+	}
+	return "OTHER"
+}
+
+func observeRequest(svc *ServiceState, r *http.Request, rec *statusRecorder, start time.Time) {
+	name := svc.Config().Name
+	requestsTotal.WithLabelValues(name, metricMethod(r.Method), strconv.Itoa(rec.code())).Inc()
+	requestDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+}
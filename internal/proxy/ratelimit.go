@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"conslee/internal/config"
+)
+
+// Rate and concurrency limits
+
+const (
+	defaultQueueTimeout  = 10 * time.Second
+	clientLimiterIdleTTL = 10 * time.Minute
+)
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type limitState struct {
+	once sync.Once
+
+	service *rate.Limiter
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+
+	slots   chan struct{}
+	waiting atomic.Int64
+}
+
+func newLimiter(rps float64, burst int) *rate.Limiter {
+	if burst <= 0 {
+		burst = int(math.Ceil(rps))
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(rps), burst)
+}
+
+func (s *ServiceState) limits() *limitState {
+	l := &s.limit
+	l.once.Do(func() {
+		rc := s.Config().RateLimit
+		if rc.RequestsPerSecond > 0 {
+			l.service = newLimiter(rc.RequestsPerSecond, rc.Burst)
+		}
+		if rc.PerClientRequestsPerSecond > 0 {
+			l.clients = map[string]*clientLimiter{}
+		}
+		if rc.MaxConcurrent > 0 {
+			l.slots = make(chan struct{}, rc.MaxConcurrent)
+		}
+	})
+	return l
+}
+
+func (l *limitState) clientLimiter(ip string, rc *config.RateLimitConfig) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > clientLimiterIdleTTL {
+		for k, cl := range l.clients {
+			if now.Sub(cl.lastSeen) > clientLimiterIdleTTL {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	cl, ok := l.clients[ip]
+	if !ok {
+		cl = &clientLimiter{limiter: newLimiter(rc.PerClientRequestsPerSecond, rc.PerClientBurst)}
+		l.clients[ip] = cl
+	}
+	cl.lastSeen = now
+	return cl.limiter
+}
+
+// allow takes a token from the limiter, or returns how long the caller
+// should wait before retrying.
+func allow(lim *rate.Limiter) (bool, time.Duration) {
+	res := lim.Reserve()
+	if !res.OK() {
+		return false, time.Second
+	}
+	if d := res.Delay(); d > 0 {
+		res.Cancel()
+		return false, d
+	}
+	return true, 0
+}
+
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration, msg string) {
+	secs := int(math.Ceil(retryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	http.Error(w, msg, http.StatusTooManyRequests)
+}
+
+// acquire applies the rate limits and reserves a concurrency slot. When the
+// request may proceed it returns a release function (possibly a no-op);
+// otherwise it has written a 429 response and returns nil.
+func (c *Conslee) acquire(ctx context.Context, w http.ResponseWriter, r *http.Request, svc *ServiceState) func() {
+	rc := svc.Config().RateLimit
+	if rc == nil {
+		return func() {}
+	}
+	l := svc.limits()
+
+	if l.clients != nil {
+		if ok, wait := allow(l.clientLimiter(getClientIP(r), rc)); !ok {
+			tooManyRequests(w, wait, "too many requests from this client")
+			return nil
+		}
+	}
+	if l.service != nil {
+		if ok, wait := allow(l.service); !ok {
+			tooManyRequests(w, wait, "too many requests")
+			return nil
+		}
+	}
+
+	if l.slots == nil {
+		return func() {}
+	}
+	release := func() { <-l.slots }
+
+	select {
+	case l.slots <- struct{}{}:
+		return release
+	default:
+	}
+
+	if l.waiting.Add(1) > int64(rc.MaxQueue) {
+		l.waiting.Add(-1)
+		tooManyRequests(w, time.Second, "too many concurrent requests")
+		return nil
+	}
+	defer l.waiting.Add(-1)
+
+	timeout := rc.QueueTimeout
+	if timeout <= 0 {
+		timeout = defaultQueueTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return release
+	case <-timer.C:
+		tooManyRequests(w, time.Second, "too many concurrent requests")
+		return nil
+	case <-ctx.Done():
+		return nil
+	}
+}
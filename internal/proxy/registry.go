@@ -26,18 +26,18 @@ func (r *ServiceRegistry) Add(host string, s *ServiceState) {
 	if host != "" {
 		r.byHost[host] = s
 	}
-	r.byName[s.Config.Name] = s
+	r.byName[s.Config().Name] = s
 }
 
-func (r *ServiceRegistry) UpdateHost(s *ServiceState, newHost string) {
+// UpdateHost moves s from oldHost to the host of its current settings.
+func (r *ServiceRegistry) UpdateHost(s *ServiceState, oldHost string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if s.Config.Host != "" {
-		delete(r.byHost, s.Config.Host)
+	if oldHost != "" && r.byHost[oldHost] == s {
+		delete(r.byHost, oldHost)
 	}
-	s.Config.Host = newHost
-	if newHost != "" {
-		r.byHost[newHost] = s
+	if host := s.Config().Host; host != "" {
+		r.byHost[host] = s
 	}
 }
 
@@ -45,7 +45,7 @@ func (r *ServiceRegistry) DelByName(name string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if s, ok := r.byName[name]; ok {
-		delete(r.byHost, s.Config.Host)
+		delete(r.byHost, s.Config().Host)
 		delete(r.byName, name)
 	}
 }
@@ -87,17 +87,18 @@ func (r *ServiceRegistry) FindContainerConflict(containers []string, excludeServ
 	}
 
 	for _, svc := range r.All() {
-		if svc.Config.Name == excludeService {
+		cfg := svc.Config()
+		if cfg.Name == excludeService {
 			continue
 		}
-		for _, ex := range svc.Config.Containers {
+		for _, ex := range svc.ContainerNames() {
 			if _, ok := set[ex]; ok {
-				return svc.Config.Name, ex
+				return cfg.Name, ex
 			}
 		}
-		if svc.Config.ContainerName != "" {
-			if _, ok := set[svc.Config.ContainerName]; ok {
-				return svc.Config.Name, svc.Config.ContainerName
+		if cfg.ContainerName != "" {
+			if _, ok := set[cfg.ContainerName]; ok {
+				return cfg.Name, cfg.ContainerName
 			}
 		}
 	}
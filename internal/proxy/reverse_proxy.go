@@ -2,32 +2,104 @@ package proxy
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"strings"
+	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"conslee/internal/events"
 )
 
 // Container lifecycle
 
-func ensureRunning(ctx context.Context, rt ContainerRuntime, svc *ServiceState) error {
-	names := svc.Config.Containers
-	if len(names) == 0 && svc.Config.ContainerName != "" {
-		names = []string{svc.Config.ContainerName}
+// ensureRunning starts the service if needed. trigger says what caused the
+// start, for the event history.
+func (c *Conslee) ensureRunning(ctx context.Context, svc *ServiceState, trigger string) error {
+	_, err := c.wakeService(ctx, svc, trigger)
+	return err
+}
+
+// wakeTrigger describes a request that wakes a service. The query string is
+// left out, as it may carry credentials.
+func wakeTrigger(method, host, path, ip string) string {
+	return fmt.Sprintf("request %s %s%s from %s", method, host, path, ip)
+}
+
+// wakeService is ensureRunning that also reports whether the service had to
+// be started, and records it in the metrics and the event stream.
+func (c *Conslee) wakeService(ctx context.Context, svc *ServiceState, trigger string) (bool, error) {
+	return c.wake(ctx, svc, trigger, true)
+}
+
+// wake is wakeService; report says whether a failure is published, which
+// retries of an already reported failure leave out.
+func (c *Conslee) wake(ctx context.Context, svc *ServiceState, trigger string, report bool) (bool, error) {
+	name := svc.Config().Name
+	ctx, span := startSpan(ctx, "ensureRunning", attribute.String("conslee.service", name))
+	start := time.Now()
+	woke, err := startService(ctx, c.rt, svc, func() {
+		c.publish(events.TypeWaking, name, trigger)
+	})
+	span.SetAttributes(attribute.Bool("conslee.woke", woke))
+	endSpan(span, err)
+	if err != nil {
+		ensureRunningFailures.WithLabelValues(name).Inc()
+	}
+	if err != nil && report {
+		c.publish(events.TypeFailed, name, err.Error())
+		// The containers started but did not become ready: their output
+		// usually says why. It may contain secrets, so it goes to the
+		// server log only, and reading it must not hold up the caller.
+		if woke && (errors.Is(err, context.DeadlineExceeded) || time.Since(start) >= svc.startupTimeout()) {
+			go c.logStartupOutput(svc)
+		}
+	}
+	if woke {
+		wakesTotal.WithLabelValues(name).Inc()
+		c.recordWake(name)
+		if err == nil {
+			elapsed := time.Since(start)
+			ensureRunningDuration.WithLabelValues(name).Observe(elapsed.Seconds())
+			c.publish(events.TypeReady, name, "ready after "+elapsed.Round(time.Millisecond).String())
+		}
+	}
+	return woke, err
+}
+
+// logStartupOutput logs the last lines of the containers' output of a
+// service that did not become ready in time.
+func (c *Conslee) logStartupOutput(svc *ServiceState) {
+	if logs := c.tailLogs(svc, startupLogLines); logs != "" {
+		slog.Warn("service not ready in time", "service", svc.Config().Name, "action", "wake", "logs", logs)
 	}
-	if len(names) == 0 {
-		return fmt.Errorf("service %s has no containers", svc.Config.Name)
+}
+
+func (s *ServiceState) startupTimeout() time.Duration {
+	cfg := s.Config()
+	if cfg.StartupTimeout > 0 {
+		return cfg.StartupTimeout
 	}
+	return 30 * time.Second
+}
 
-	timeout := svc.Config.StartupTimeout
-	if timeout <= 0 {
-		timeout = 30 * time.Second
+// startService starts the stopped containers of a service and waits until
+// it is ready. waking is called before the first container is started;
+// woke reports whether anything had to be started.
+func startService(ctx context.Context, rt ContainerRuntime, svc *ServiceState, waking func()) (woke bool, err error) {
+	cfg, pool := svc.Config(), svc.Pool()
+	names := svc.sharedContainers()
+	replicas := pool.Replicas()
+	if len(names) == 0 && len(replicas) == 0 {
+		return false, fmt.Errorf("service %s has no containers", cfg.Name)
 	}
+
+	timeout := svc.startupTimeout()
 	opCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -36,44 +108,172 @@ func ensureRunning(ctx context.Context, rt ContainerRuntime, svc *ServiceState)
 	for _, name := range names {
 		st, err := rt.Inspect(opCtx, name)
 		if err != nil {
-			return fmt.Errorf("inspect %s: %w", name, err)
+			return needWait, fmt.Errorf("inspect %s: %w", name, err)
 		}
 		if st.Running {
 			continue
 		}
-		log.Printf("starting container %s for service %s...", name, svc.Config.Name)
+		if !needWait {
+			waking()
+		}
+		slog.Info("starting container", "service", cfg.Name, "container", name, "action", "start")
 		if err := rt.Start(opCtx, name); err != nil {
-			return fmt.Errorf("start %s: %w", name, err)
+			return true, fmt.Errorf("start %s: %w", name, err)
 		}
 		needWait = true
 	}
 
-	if !needWait {
-		return nil
+	// Replicas: refresh their state and start stopped ones until the
+	// minimum replica count is running. The rest are started under load.
+	running := 0
+	var stopped []*Upstream
+	for _, u := range replicas {
+		st, err := rt.Inspect(opCtx, u.Container)
+		if err != nil {
+			return needWait, fmt.Errorf("inspect %s: %w", u.Container, err)
+		}
+		u.setUp(st.Running)
+		if st.Running {
+			running++
+		} else {
+			stopped = append(stopped, u)
+		}
 	}
 
-	hostPort := ""
-	if svc.Target != nil {
-		hostPort = svc.Target.Host
+	var started []*Upstream
+	for _, u := range stopped {
+		if running+len(started) >= svc.minReplicas() {
+			break
+		}
+		if !needWait && len(started) == 0 {
+			waking()
+		}
+		slog.Info("starting replica", "service", cfg.Name, "container", u.Container, "action", "start")
+		if err := rt.Start(opCtx, u.Container); err != nil {
+			return true, fmt.Errorf("start %s: %w", u.Container, err)
+		}
+		started = append(started, u)
 	}
-	if hostPort == "" {
-		log.Printf("service %s: no TargetURL/Host, skipping TCP/HTTP readiness check", svc.Config.Name)
-		return nil
+
+	if !needWait && len(started) == 0 {
+		return false, nil
 	}
 
-	if err := waitTCP(opCtx, hostPort, timeout); err != nil {
-		return err
+	var waitFor []*Upstream
+	if needWait {
+		for _, u := range pool.All() {
+			if u.Container == "" {
+				waitFor = append(waitFor, u)
+			}
+		}
+	}
+	waitFor = append(waitFor, started...)
+
+	if len(waitFor) == 0 {
+		slog.Debug("no target, skipping readiness check", "service", cfg.Name, "action", "start")
+		return true, nil
+	}
+
+	// Wait for all started upstreams in parallel; the service is usable as
+	// soon as at least one of them is ready.
+	errs := make([]error, len(waitFor))
+	var wg sync.WaitGroup
+	for i, u := range waitFor {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = pool.waitReady(opCtx, u, cfg.HealthPath, timeout)
+			if u.Container != "" {
+				u.setUp(errs[i] == nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var lastErr error
+	for _, err := range errs {
+		if err == nil {
+			return true, nil
+		}
+		lastErr = err
+	}
+	return true, lastErr
+}
+
+// isRunning reports whether the shared containers and at least one replica
+// (if the service has any) are running.
+func isRunning(ctx context.Context, rt ContainerRuntime, svc *ServiceState) (bool, error) {
+	for _, name := range svc.sharedContainers() {
+		st, err := rt.Inspect(ctx, name)
+		if err != nil {
+			return false, fmt.Errorf("inspect %s: %w", name, err)
+		}
+		if !st.Running {
+			return false, nil
+		}
+	}
+	replicas := svc.Pool().Replicas()
+	if len(replicas) == 0 {
+		return true, nil
+	}
+	for _, u := range replicas {
+		st, err := rt.Inspect(ctx, u.Container)
+		if err != nil {
+			return false, fmt.Errorf("inspect %s: %w", u.Container, err)
+		}
+		if st.Running {
+			return true, nil
+		}
 	}
-	if err := waitHTTP(opCtx, svc.Target, svc.Config.HealthPath, timeout); err != nil {
+	return false, nil
+}
+
+func (p *UpstreamPool) waitReady(ctx context.Context, u *Upstream, healthPath string, timeout time.Duration) error {
+	if u.URL == nil || u.URL.Host == "" {
+		return nil
+	}
+	if u.Socket != "" {
+		if err := waitSocket(ctx, u.Socket, timeout); err != nil {
+			return err
+		}
+	} else if err := waitTCP(ctx, u.URL.Host, timeout); err != nil {
 		return err
 	}
+	return waitHTTP(ctx, p.client(10*time.Second), u.URL, healthPath, timeout)
+}
+
+// scaleUp starts one more replica when the running ones are saturated.
+func (c *Conslee) scaleUp(svc *ServiceState) {
+	cfg, pool := svc.Config(), svc.Pool()
+	u := pool.ScaleUpCandidate(cfg.ScaleUpThreshold)
+	if u == nil {
+		return
+	}
+
+	go func() {
+		timeout := svc.startupTimeout()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
 
-	return nil
+		slog.Info("starting replica", "service", cfg.Name, "container", u.Container, "action", "scale-up")
+		if err := c.rt.Start(ctx, u.Container); err != nil {
+			slog.Error("start replica", "service", cfg.Name, "container", u.Container, "action", "scale-up", "err", err)
+			u.finishStarting(false)
+			return
+		}
+		if err := pool.waitReady(ctx, u, cfg.HealthPath, timeout); err != nil {
+			slog.Error("replica not ready", "service", cfg.Name, "container", u.Container, "action", "scale-up", "err", err)
+			u.finishStarting(false)
+			return
+		}
+		u.finishStarting(true)
+	}()
 }
 
 // Reverse proxy
 
 func (c *Conslee) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = c.resolveClient(r)
 	host := r.Host
 	svc, ok := c.reg.GetByHost(host)
 	if !ok {
@@ -81,12 +281,25 @@ func (c *Conslee) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			http.Redirect(w, r, "/ui/", http.StatusFound)
 			return
 		}
-		log.Printf("unknown host: %s", host)
+		slog.Debug("unknown host", "host", host)
 		http.Error(w, "unknown host", http.StatusBadGateway)
 		return
 	}
 
-	if svc.Config.Disabled {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w}
+	info := &requestInfo{}
+	w = rec
+
+	r, span := traceRequest(r, svc)
+	r = r.WithContext(withRequestInfo(r.Context(), info))
+	defer func() {
+		endRequestSpan(span, rec.code())
+		c.finishRequest(svc, r, rec, info, start)
+	}()
+
+	cfg := svc.Config()
+	if cfg.Disabled {
 		http.Error(w, "service is disabled", http.StatusServiceUnavailable)
 		return
 	}
@@ -97,9 +310,28 @@ func (c *Conslee) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	now := time.Now()
 	shouldUp := false
 	mode := ModeOnDemand
-	if svc.Schedule != nil {
-		shouldUp = svc.ShouldBeUp(now)
-		mode = svc.Schedule.Mode
+	sched := svc.Schedule()
+	if sched != nil {
+		shouldUp = sched.ShouldBeUp(now)
+		mode = sched.Mode
+	}
+
+	// Access policies run before anything can wake the service.
+	if !skipEnsure {
+		if !svc.clientAllowed(getClientIP(r)) {
+			slog.Info("client rejected by IP rules", "service", cfg.Name, "client", getClientIP(r))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if !c.checkAccess(w, r, svc) {
+			return
+		}
+
+		release := c.acquire(r.Context(), w, r, svc)
+		if release == nil {
+			return
+		}
+		defer release()
 	}
 
 	switch mode {
@@ -111,111 +343,78 @@ func (c *Conslee) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		fallthrough
 	case ModeBoth, ModeOnDemand:
 		if skipEnsure {
-			w.Header().Set(probeSignatureHeader, svc.Config.Name)
+			w.Header().Set(probeSignatureHeader, cfg.Name)
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
-		if err := ensureRunning(r.Context(), c.rt, svc); err != nil {
-			log.Printf("ensureRunning error for %s: %v", svc.Config.Name, err)
+		if !svc.canWake(r) {
+			if c.serveWithoutWake(r.Context(), w, svc) {
+				return
+			}
+			// Running already: proxy without counting as activity, so
+			// crawlers do not keep the service awake.
+			c.proxyToUpstream(w, r, svc, false)
+			return
+		}
+		if c.shouldBuffer(r.Context(), r, svc) {
+			info.woke.Store(true)
+			c.bufferRequest(w, r, svc)
+			return
+		}
+		woke, err := c.wakeService(r.Context(), svc, wakeTrigger(r.Method, r.Host, r.URL.Path, getClientIP(r)))
+		info.woke.Store(woke)
+		if err != nil {
+			slog.Error("wake failed", "service", cfg.Name, "action", "wake", "err", err)
 			http.Error(w, "backend unavailable", http.StatusBadGateway)
 			return
 		}
 	}
 
-	if svc.Target == nil {
+	c.proxyToUpstream(w, r, svc, true)
+}
+
+func (c *Conslee) proxyToUpstream(w http.ResponseWriter, r *http.Request, svc *ServiceState, activity bool) {
+	pool := svc.Pool()
+	upstream := pool.Pick()
+	if upstream == nil {
 		http.Error(w, "service has no target configured", http.StatusServiceUnavailable)
 		return
 	}
 
-	svc.LastActivity = time.Now()
+	if activity {
+		svc.LastActivity = time.Now()
+	}
 
-	proxy := newSingleHostReverseProxy(svc.Target, r)
-	proxy.ModifyResponse = func(resp *http.Response) error {
-		resp.Header.Set(probeSignatureHeader, svc.Config.Name)
-		return nil
+	upstream.active.Add(1)
+	defer upstream.active.Add(-1)
+	if activity {
+		c.scaleUp(svc)
 	}
-	proxy.ServeHTTP(w, r)
-}
 
-func newSingleHostReverseProxy(target *url.URL, src *http.Request) *httputil.ReverseProxy {
-	proxy := httputil.NewSingleHostReverseProxy(target)
-	proxy.Transport = &http.Transport{
-		Proxy:             http.ProxyFromEnvironment,
-		DialContext:       (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 0}).DialContext,
-		ForceAttemptHTTP2: false,
-		DisableKeepAlives: true,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	}
-	orig := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		orig(req)
-		req.Host = src.Host
-		copyHeaders(src, req)
-		setForwardedHeaders(src, req)
-	}
-	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
-		log.Printf("proxy error for host=%s path=%s: %v", src.Host, req.URL.Path, err)
-		http.Error(rw, "proxy error", http.StatusBadGateway)
-	}
-	return proxy
+	pool.reverseProxy(upstream).ServeHTTP(w, r)
 }
 
 // Header handling
 
-func copyHeaders(src, dst *http.Request) {
-	hopByHopHeaders := map[string]bool{
-		"Connection":          true,
-		"Keep-Alive":          true,
-		"Proxy-Authenticate":  true,
-		"Proxy-Authorization": true,
-		"Te":                  true,
-		"Trailers":            true,
-		"Transfer-Encoding":   true,
-		"Upgrade":             true,
-	}
-
-	for key, values := range src.Header {
-		if hopByHopHeaders[key] {
-			continue
-		}
-		dst.Header[key] = values
-	}
-
-	// Handle Connection header for WebSocket upgrades
-	if conn := src.Header.Get("Connection"); conn != "" {
-		dst.Header.Set("Connection", conn)
-	}
-
-	// Handle Upgrade header for WebSocket
-	if upgrade := src.Header.Get("Upgrade"); upgrade != "" {
-		dst.Header.Set("Upgrade", upgrade)
-	}
-}
-
-// setForwardedHeaders sets X-Real-IP, X-Forwarded-For, X-Forwarded-Host, and X-Forwarded-Proto headers
+// setForwardedHeaders sets X-Real-IP, X-Forwarded-For, X-Forwarded-Host, and X-Forwarded-Proto headers.
+// Incoming forwarded headers of src are only present when they came from a
+// trusted proxy; resolveClient removes the others.
 func setForwardedHeaders(src, dst *http.Request) {
-	// Handle X-Real-IP: forward if exists, otherwise set from RemoteAddr
-	if v := src.Header.Get("X-Real-IP"); v != "" {
-		dst.Header.Set("X-Real-IP", v)
-	} else if ip := extractIPFromRemoteAddr(src.RemoteAddr); ip != "" {
+	// Handle X-Real-IP: the resolved client address
+	if ip := getClientIP(src); ip != "" {
 		dst.Header.Set("X-Real-IP", ip)
 	}
 
-	// Handle X-Forwarded-For: append client IP
-	clientIP := extractIPFromRemoteAddr(src.RemoteAddr)
-	if clientIP == "" {
-		clientIP = getClientIP(src)
-	}
-	if clientIP != "" {
-		if existing := src.Header.Get("X-Forwarded-For"); existing != "" {
-			dst.Header.Set("X-Forwarded-For", existing+", "+clientIP)
+	// Handle X-Forwarded-For: append the peer address
+	existing := strings.Join(src.Header.Values("X-Forwarded-For"), ", ")
+	if peer := extractIPFromRemoteAddr(src.RemoteAddr); peer != "" {
+		if existing != "" {
+			dst.Header.Set("X-Forwarded-For", existing+", "+peer)
 		} else {
-			dst.Header.Set("X-Forwarded-For", clientIP)
+			dst.Header.Set("X-Forwarded-For", peer)
 		}
-	} else if v := src.Header.Get("X-Forwarded-For"); v != "" {
-		dst.Header.Set("X-Forwarded-For", v)
+	} else if existing != "" {
+		dst.Header.Set("X-Forwarded-For", existing)
 	}
 
 	// Handle X-Forwarded-Host
@@ -248,19 +447,11 @@ func extractIPFromRemoteAddr(remoteAddr string) string {
 	return ip
 }
 
-// getClientIP extracts the client IP address from the request headers
-// Used as fallback when RemoteAddr is not available
+// getClientIP returns the client IP resolved by resolveClient, or the peer
+// address for requests that did not pass through it.
 func getClientIP(r *http.Request) string {
-	// Check X-Real-IP first (set by upstream proxy)
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok && ip != "" {
 		return ip
 	}
-	// Check X-Forwarded-For (may contain multiple IPs, take the first)
-	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-		ips := strings.Split(forwarded, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-	return ""
+	return extractIPFromRemoteAddr(r.RemoteAddr)
 }
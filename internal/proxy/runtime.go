@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"context"
+	"io"
 	"time"
 )
 
@@ -12,12 +13,45 @@ type ContainerRuntime interface {
 	Start(ctx context.Context, name string) error
 	Stop(ctx context.Context, name string, timeout time.Duration) error
 	List(ctx context.Context, all bool) ([]ContainerInfo, error)
+	// Events streams container state changes until ctx is done or the
+	// connection fails, which is sent on the error channel.
+	Events(ctx context.Context) (<-chan ContainerEvent, <-chan error)
+	// Stats samples the resource usage of a running container.
+	Stats(ctx context.Context, name string) (ContainerStats, error)
+	// Logs returns the output of a container, stdout and stderr merged.
+	// With Follow, the reader stays open until ctx is done or the reader is
+	// closed.
+	Logs(ctx context.Context, name string, opts LogOptions) (io.ReadCloser, error)
+}
+
+// LogOptions selects the log lines returned by Logs. A zero Since means
+// from the start and a zero Tail all lines.
+type LogOptions struct {
+	Since      time.Time
+	Tail       int
+	Follow     bool
+	Timestamps bool
 }
 
 type ContainerState struct {
 	Running bool
 }
 
+// ContainerEvent is a change of a container's state: one of
+// events.StateRunning, StateStopped or StatePaused.
+type ContainerEvent struct {
+	Name  string
+	State string
+	Time  time.Time
+}
+
+// ContainerStats is a sample of a container's resource usage. CPUCores is
+// CPU time used per second, so 0.5 is half of one core.
+type ContainerStats struct {
+	CPUCores    float64
+	MemoryBytes uint64
+}
+
 type Port struct {
 	IP      string
 	Private uint16
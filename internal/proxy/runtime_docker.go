@@ -2,12 +2,19 @@ package proxy
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
+	dockerevents "github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"conslee/internal/events"
 )
 
 // Docker runtime implementation
@@ -116,3 +123,134 @@ func (d *DockerRuntime) List(ctx context.Context, all bool) ([]ContainerInfo, er
 	}
 	return out, nil
 }
+
+func (d *DockerRuntime) Events(ctx context.Context) (<-chan ContainerEvent, <-chan error) {
+	msgs, errs := d.cli.Events(ctx, dockerevents.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(dockerevents.ContainerEventType)),
+			filters.Arg("event", string(dockerevents.ActionStart)),
+			filters.Arg("event", string(dockerevents.ActionDie)),
+			filters.Arg("event", string(dockerevents.ActionPause)),
+			filters.Arg("event", string(dockerevents.ActionUnPause)),
+		),
+	})
+
+	out := make(chan ContainerEvent)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case m := <-msgs:
+				ev := ContainerEvent{
+					Name: m.Actor.Attributes["name"],
+					Time: time.Unix(0, m.TimeNano),
+				}
+				switch m.Action {
+				case dockerevents.ActionStart, dockerevents.ActionUnPause:
+					ev.State = events.StateRunning
+				case dockerevents.ActionDie:
+					ev.State = events.StateStopped
+				case dockerevents.ActionPause:
+					ev.State = events.StatePaused
+				default:
+					continue
+				}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			case err := <-errs:
+				errc <- err
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, errc
+}
+
+// Stats takes two samples about a second apart, as docker stats does, to
+// compute the CPU usage.
+func (d *DockerRuntime) Stats(ctx context.Context, name string) (ContainerStats, error) {
+	resp, err := d.cli.ContainerStats(ctx, name, false)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	defer resp.Body.Close()
+
+	var st container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return ContainerStats{}, err
+	}
+
+	var out ContainerStats
+	cpuDelta := float64(st.CPUStats.CPUUsage.TotalUsage) - float64(st.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(st.CPUStats.SystemUsage) - float64(st.PreCPUStats.SystemUsage)
+	cpus := float64(st.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(st.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		out.CPUCores = cpuDelta / systemDelta * cpus
+	}
+
+	// Page cache can be reclaimed and is not counted, as in docker stats.
+	mem := st.MemoryStats.Usage
+	for _, key := range []string{"inactive_file", "total_inactive_file"} {
+		if v, ok := st.MemoryStats.Stats[key]; ok && v < mem {
+			mem -= v
+			break
+		}
+	}
+	out.MemoryBytes = mem
+	return out, nil
+}
+
+// Logs demultiplexes the output of containers without a TTY, where Docker
+// frames stdout and stderr.
+func (d *DockerRuntime) Logs(ctx context.Context, name string, opts LogOptions) (io.ReadCloser, error) {
+	insp, err := d.cli.ContainerInspect(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	lo := container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Timestamps: opts.Timestamps,
+	}
+	if !opts.Since.IsZero() {
+		lo.Since = opts.Since.Format(time.RFC3339Nano)
+	}
+	if opts.Tail > 0 {
+		lo.Tail = strconv.Itoa(opts.Tail)
+	}
+	rc, err := d.cli.ContainerLogs(ctx, name, lo)
+	if err != nil {
+		return nil, err
+	}
+	if insp.Config != nil && insp.Config.Tty {
+		return rc, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, rc)
+		pw.CloseWithError(err)
+	}()
+	return demuxedLogs{pr, rc}, nil
+}
+
+type demuxedLogs struct {
+	*io.PipeReader
+	src io.Closer
+}
+
+// Close also closes the Docker stream, which ends the copy.
+func (l demuxedLogs) Close() error {
+	_ = l.src.Close()
+	return l.PipeReader.Close()
+}
@@ -2,8 +2,15 @@ package proxy
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"conslee/internal/audit"
+	"conslee/internal/events"
 )
 
 // Scheduler
@@ -27,68 +34,167 @@ func (c *Conslee) StartIdleReaper(ctx context.Context, interval time.Duration) {
 func (c *Conslee) reapIdle(ctx context.Context) {
 	now := time.Now()
 	for _, svc := range c.reg.All() {
-		if svc.Config.Disabled {
+		cfg := svc.Config()
+		if cfg.Disabled {
 			continue
 		}
-		if svc.Config.IdleTimeout <= 0 {
+		if cfg.IdleTimeout <= 0 {
 			continue
 		}
 		idle := now.Sub(svc.LastActivity)
-		if idle < svc.Config.IdleTimeout {
+		if idle < cfg.IdleTimeout {
 			continue
 		}
 
-		names := append([]string(nil), svc.Config.Containers...)
-		if len(names) == 0 && svc.Config.ContainerName != "" {
-			names = []string{svc.Config.ContainerName}
-		}
+		names := svc.ContainerNames()
 
+		var stopped []string
 		for _, name := range names {
 			st, err := c.rt.Inspect(ctx, name)
 			if err != nil {
-				log.Printf("inspect %s in reapIdle: %v", name, err)
+				slog.Warn("inspect container", "service", cfg.Name, "container", name, "action", "idle-stop", "err", err)
 				continue
 			}
 			if !st.Running {
 				continue
 			}
-			log.Printf("stopping container %s for service %s (idle %v > %v)", name, svc.Config.Name, idle, svc.Config.IdleTimeout)
+			slog.Info("stopping idle container", "service", cfg.Name, "container", name, "action", "idle-stop", "idle", idle.Round(time.Second), "idle_timeout", cfg.IdleTimeout)
 			if err := c.rt.Stop(ctx, name, 0); err != nil {
-				log.Printf("stop %s error: %v", name, err)
+				slog.Error("stop container", "service", cfg.Name, "container", name, "action", "idle-stop", "err", err)
+				continue
 			}
+			stopped = append(stopped, name)
+		}
+		if len(stopped) > 0 {
+			idleStopsTotal.WithLabelValues(cfg.Name).Inc()
+			detail := fmt.Sprintf("idle %v; stopped %s", idle.Round(time.Second), strings.Join(stopped, ", "))
+			c.recordAs(audit.ActorIdleReaper, audit.ActionIdleStop, cfg.Name, detail, nil)
+			c.publish(events.TypeIdleStopped, cfg.Name, detail)
 		}
 	}
 }
 
+// scheduleState tracks the scheduled start of a service in its current
+// window. A failed start is retried with backoff, and only the first
+// failure in a row is reported.
+type scheduleState struct {
+	starting atomic.Bool
+
+	mu       sync.Mutex
+	failures int       // failed starts in a row
+	retryAt  time.Time // no start is attempted before
+}
+
+const (
+	scheduleRetryMin = time.Minute
+	scheduleRetryMax = 30 * time.Minute
+)
+
+// due reports whether a start may be attempted at now.
+func (st *scheduleState) due(now time.Time) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return !now.Before(st.retryAt)
+}
+
+// retrying reports whether the last start failed.
+func (st *scheduleState) retrying() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.failures > 0
+}
+
+// fail records a failed start. It returns the failures in a row and the
+// delay until the next attempt.
+func (st *scheduleState) fail(now time.Time) (int, time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.failures++
+	delay := scheduleRetryMax
+	if st.failures <= 5 {
+		delay = min(scheduleRetryMin<<(st.failures-1), scheduleRetryMax)
+	}
+	st.retryAt = now.Add(delay)
+	return st.failures, delay
+}
+
+func (st *scheduleState) reset() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.failures = 0
+	st.retryAt = time.Time{}
+}
+
 func (c *Conslee) runSchedule(ctx context.Context) {
 	now := time.Now()
 	for _, svc := range c.reg.All() {
-		if svc.Config.Disabled {
+		if svc.Config().Disabled {
 			continue
 		}
-		if svc.Schedule == nil {
+		schedule := svc.Schedule()
+		if schedule == nil {
 			continue
 		}
-		if !svc.ShouldBeUp(now) {
-			if svc.Schedule.Mode == ModeScheduleOnly {
-				names := append([]string(nil), svc.Config.Containers...)
-				if len(names) == 0 && svc.Config.ContainerName != "" {
-					names = []string{svc.Config.ContainerName}
-				}
-				for _, name := range names {
-					_ = c.rt.Stop(ctx, name, 0)
-				}
+		if !schedule.ShouldBeUp(now) {
+			svc.sched.reset()
+			if schedule.Mode == ModeScheduleOnly {
+				c.stopScheduled(ctx, svc)
 			}
 			continue
 		}
 
-		if svc.Schedule.Mode == ModeScheduleOnly || svc.Schedule.Mode == ModeBoth {
+		if schedule.Mode == ModeScheduleOnly || schedule.Mode == ModeBoth {
+			// A failed start is not retried on every tick; requests may
+			// still wake it in between.
+			if !svc.sched.due(now) || !svc.sched.starting.CompareAndSwap(false, true) {
+				continue
+			}
 			s := svc
 			go func() {
-				if err := ensureRunning(ctx, c.rt, s); err != nil {
-					log.Printf("scheduled start error for %s: %v", s.Config.Name, err)
+				defer s.sched.starting.Store(false)
+				cfg := s.Config()
+				retrying := s.sched.retrying()
+				woke, err := c.wake(ctx, s, "schedule", !retrying)
+				if err != nil {
+					n, delay := s.sched.fail(time.Now())
+					if !retrying {
+						slog.Error("scheduled start failed", "service", cfg.Name, "action", "schedule-start", "retry_in", delay, "err", err)
+					} else {
+						slog.Warn("scheduled start failed again", "service", cfg.Name, "action", "schedule-start", "failures", n, "retry_in", delay, "err", err)
+					}
+					return
+				}
+				s.sched.reset()
+				if woke {
+					scheduleActionsTotal.WithLabelValues(cfg.Name, "start").Inc()
+					c.recordAs(audit.ActorScheduler, audit.ActionScheduleStart, cfg.Name, "", nil)
 				}
 			}()
 		}
 	}
 }
+
+// stopScheduled stops a service outside its schedule window. Only containers
+// that were still running are recorded, so the audit log is not flooded on
+// every tick.
+func (c *Conslee) stopScheduled(ctx context.Context, svc *ServiceState) {
+	var stopped []string
+	cfg := svc.Config()
+	for _, name := range svc.ContainerNames() {
+		if st, err := c.rt.Inspect(ctx, name); err == nil && !st.Running {
+			continue
+		}
+		slog.Info("stopping container outside schedule", "service", cfg.Name, "container", name, "action", "schedule-stop")
+		if err := c.rt.Stop(ctx, name, 0); err != nil {
+			slog.Error("stop container", "service", cfg.Name, "container", name, "action", "schedule-stop", "err", err)
+			continue
+		}
+		stopped = append(stopped, name)
+	}
+	if len(stopped) > 0 {
+		scheduleActionsTotal.WithLabelValues(cfg.Name, "stop").Inc()
+		detail := "stopped " + strings.Join(stopped, ", ")
+		c.recordAs(audit.ActorScheduler, audit.ActionScheduleStop, cfg.Name, detail, nil)
+		c.publish(events.TypeScheduleStopped, cfg.Name, detail)
+	}
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"conslee/internal/config"
+)
+
+// Upstream TLS
+
+// tlsVerifyEnabled reports whether upstream certificates are checked. An
+// explicit verify setting wins; otherwise a custom CA implies verification.
+func tlsVerifyEnabled(tc *config.UpstreamTLSConfig) bool {
+	if tc == nil {
+		return false
+	}
+	if tc.Verify != nil {
+		return *tc.Verify
+	}
+	return tc.CAFile != ""
+}
+
+// warnUnverifiedTLS logs every HTTPS upstream of a service whose
+// certificate is not checked.
+func warnUnverifiedTLS(cfg config.ServiceConfig, pool *UpstreamPool) {
+	if tlsVerifyEnabled(cfg.TLS) {
+		return
+	}
+	for _, u := range pool.All() {
+		if u.URL.Scheme == "https" {
+			slog.Warn("TLS certificate of upstream is not verified; set tls.verify to enable", "service", cfg.Name, "upstream", u.URL.Host)
+		}
+	}
+}
+
+// tlsFileError is a failure to load a TLS file of a service. It tells
+// whether a path exists on the host, so it is logged rather than returned
+// to API clients.
+type tlsFileError struct{ err error }
+
+func (e *tlsFileError) Error() string { return e.err.Error() }
+func (e *tlsFileError) Unwrap() error { return e.err }
+
+// hasFiles reports whether the settings name files on the host.
+func (d *UpstreamTLSDTO) hasFiles() bool {
+	return d != nil && (d.CAFile != "" || d.CertFile != "" || d.KeyFile != "")
+}
+
+// newUpstreamTLSConfig builds the client TLS config used for proxying,
+// readiness checks and probes of a service.
+func newUpstreamTLSConfig(tc *config.UpstreamTLSConfig) (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: !tlsVerifyEnabled(tc),
+	}
+	if tc == nil {
+		return cfg, nil
+	}
+
+	cfg.ServerName = tc.ServerName
+
+	if tc.CAFile != "" {
+		pem, err := os.ReadFile(tc.CAFile)
+		if err != nil {
+			return nil, &tlsFileError{fmt.Errorf("read ca_file: %w", err)}
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, &tlsFileError{fmt.Errorf("ca_file %s contains no certificates", tc.CAFile)}
+		}
+		cfg.RootCAs = pool
+	}
+
+	if tc.CertFile != "" || tc.KeyFile != "" {
+		if tc.CertFile == "" || tc.KeyFile == "" {
+			return nil, fmt.Errorf("cert_file and key_file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, &tlsFileError{fmt.Errorf("load client certificate: %w", err)}
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
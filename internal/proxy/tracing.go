@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing. Spans go to the global tracer provider, which discards them
+// unless tracing is enabled in the config.
+
+var tracer = otel.Tracer("conslee/internal/proxy")
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceRequest continues the trace of an incoming request, if it carries a
+// W3C traceparent header, in a server span.
+func traceRequest(r *http.Request, svc *ServiceState) (*http.Request, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	cfg := svc.Config()
+	ctx, span := tracer.Start(ctx, "proxy "+cfg.Name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("conslee.service", cfg.Name),
+			attribute.String("http.request.method", r.Method),
+			attribute.String("server.address", r.Host),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("client.address", getClientIP(r)),
+		))
+	return r.WithContext(ctx), span
+}
+
+func endRequestSpan(span trace.Span, status int) {
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// tracingTransport wraps upstream round trips in a client span, passes the
+// trace context on to the backend and adds the time taken to the request
+// info for the access log.
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if info := requestInfoFrom(req.Context()); info != nil {
+		start := time.Now()
+		defer func() { info.upstream.Add(int64(time.Since(start))) }()
+	}
+
+	ctx, span := tracer.Start(req.Context(), "upstream "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+			// Not url.full: the query string may carry credentials.
+			attribute.String("url.scheme", req.URL.Scheme),
+			attribute.String("url.path", req.URL.Path),
+		))
+	if !span.SpanContext().IsValid() {
+		span.End()
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	span.End()
+	return resp, nil
+}
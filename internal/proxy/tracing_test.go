@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracingTransport(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		_ = tp.Shutdown(t.Context())
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	var traceparent string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer backend.Close()
+
+	ctx, parent := tracer.Start(t.Context(), "parent")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, backend.URL+"/hook?token=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tracingTransport{base: http.DefaultTransport}.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	parent.End()
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "upstream GET" || span.SpanKind() != trace.SpanKindClient {
+		t.Errorf("span %q of kind %v", span.Name(), span.SpanKind())
+	}
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("upstream span is not a child of the request span")
+	}
+	if want := "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"; traceparent != want {
+		t.Errorf("traceparent = %q, want %q", traceparent, want)
+	}
+
+	attrs := map[string]string{}
+	for _, kv := range span.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if _, ok := attrs["url.full"]; ok {
+		t.Errorf("url.full recorded: %q", attrs["url.full"])
+	}
+	for k, want := range map[string]string{
+		"url.scheme":                "http",
+		"url.path":                  "/hook",
+		"http.request.method":       "GET",
+		"http.response.status_code": "502",
+	} {
+		if attrs[k] != want {
+			t.Errorf("%s = %q, want %q", k, attrs[k], want)
+		}
+	}
+	if span.Status().Description != "502 Bad Gateway" {
+		t.Errorf("status = %+v, want error for 502", span.Status())
+	}
+}
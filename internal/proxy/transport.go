@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"conslee/internal/config"
+)
+
+// Upstream transport
+
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 16
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// newUpstreamTransport builds the keep-alive transport shared by all upstreams
+// of a service.
+func newUpstreamTransport(tc *config.TransportConfig, tlsCfg *tls.Config, sockets map[string]string) *http.Transport {
+	if tc == nil {
+		tc = &config.TransportConfig{}
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	t := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			if _, ok := sockets[canonicalAddr(req.URL)]; ok {
+				return nil, nil
+			}
+			return http.ProxyFromEnvironment(req)
+		},
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if socket, ok := sockets[addr]; ok {
+				return dialer.DialContext(ctx, "unix", socket)
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   defaultMaxIdleConnsPerHost,
+		MaxConnsPerHost:       tc.MaxConnsPerHost,
+		IdleConnTimeout:       defaultIdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     tc.HTTP2,
+		TLSClientConfig:       tlsCfg,
+	}
+	if tc.MaxIdleConns > 0 {
+		t.MaxIdleConns = tc.MaxIdleConns
+	}
+	if tc.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = tc.MaxIdleConnsPerHost
+	}
+	if tc.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = tc.IdleConnTimeout
+	}
+
+	if tc.H2C {
+		// Prior-knowledge HTTP/2 for http:// targets; HTTP/1 is left out so
+		// the transport doesn't fall back to it.
+		var p http.Protocols
+		p.SetUnencryptedHTTP2(true)
+		p.SetHTTP2(true)
+		t.Protocols = &p
+	}
+
+	return t
+}
+
+func canonicalAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// reverseProxy returns the cached reverse proxy of the upstream, creating it
+// on first use.
+func (p *UpstreamPool) reverseProxy(u *Upstream) *httputil.ReverseProxy {
+	u.proxyOnce.Do(func() {
+		// Rewrite (unlike Director) starts from a request without forwarded
+		// headers and does not append X-Forwarded-For a second time.
+		proxy := &httputil.ReverseProxy{Transport: tracingTransport{p.transport}}
+		proxy.Rewrite = func(pr *httputil.ProxyRequest) {
+			pr.SetURL(u.URL)
+			pr.Out.Host = pr.In.Host
+			if _, ok := pr.Out.Header["User-Agent"]; !ok {
+				pr.Out.Header.Set("User-Agent", "")
+			}
+			setForwardedHeaders(pr.In, pr.Out)
+		}
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			p.ReportSuccess(u)
+			resp.Header.Set(probeSignatureHeader, p.service)
+			return nil
+		}
+		proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+			slog.Error("proxy error", "service", p.service, "host", req.Host, "path", req.URL.Path, "err", err)
+			if !errors.Is(err, context.Canceled) && p.ReportFailure(u) {
+				slog.Warn("ejecting upstream after repeated failures", "service", p.service, "upstream", u.URL.Host)
+			}
+			http.Error(rw, "proxy error", http.StatusBadGateway)
+		}
+		u.proxy = proxy
+	})
+	return u.proxy
+}
+
+// client returns an HTTP client sharing the pool transport, so readiness
+// checks and probes use the same TLS settings as proxied requests.
+func (p *UpstreamPool) client(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: tracingTransport{p.transport}, Timeout: timeout}
+}
+
+// Close drops pooled connections. It is called when the pool is replaced
+// after the service targets change.
+func (p *UpstreamPool) Close() {
+	if p == nil || p.transport == nil {
+		return
+	}
+	p.transport.CloseIdleConnections()
+}
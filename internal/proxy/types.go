@@ -1,10 +1,11 @@
 package proxy
 
 import (
-	"log"
-	"net/url"
+	"log/slog"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"conslee/internal/config"
@@ -38,11 +39,23 @@ func (s *ServiceSchedule) ModeString() string {
 	}
 }
 
+// ServiceState is a proxied service. Its settings, upstream pool and
+// schedule form an immutable snapshot that update replaces as a whole.
+// Each call of Config, Pool or Schedule may return a newer one, so code
+// that uses them more than once loads them once and keeps the result.
 type ServiceState struct {
-	Config       config.ServiceConfig
-	Target       *url.URL
+	// mu serializes updates; readers load the snapshot without locking.
+	mu       sync.Mutex
+	settings atomic.Pointer[serviceSettings]
+
 	LastActivity time.Time
-	Schedule     *ServiceSchedule
+
+	replay    replayQueue
+	basicAuth basicAuthCache
+	ipCache   ipRulesCache
+	wake      wakeState
+	sched     scheduleState
+	limit     limitState
 }
 
 // DTOs
@@ -67,11 +80,63 @@ type ServiceStatusDTO struct {
 	TargetURL      string              `json:"targetUrl"`
 	HealthPath     string              `json:"healthPath"`
 	Schedule       *ServiceScheduleDTO `json:"schedule,omitempty"`
+
+	TargetURLs        []string      `json:"targetUrls,omitempty"`
+	ReplicaContainers []string      `json:"replicaContainers,omitempty"`
+	LoadBalancer      string        `json:"loadBalancer,omitempty"`
+	MinReplicas       int           `json:"minReplicas,omitempty"`
+	Upstreams         []UpstreamDTO `json:"upstreams,omitempty"`
+
+	TLS *UpstreamTLSDTO `json:"tls,omitempty"`
+
+	Owners      []string               `json:"owners,omitempty"`
+	Labels      map[string]string      `json:"labels,omitempty"`
+	Permissions *ServicePermissionsDTO `json:"permissions,omitempty"`
+
+	SuppressedWakes int64 `json:"suppressedWakes,omitempty"`
+}
+
+// ServicePermissionsDTO tells the UI which actions the caller may perform.
+type ServicePermissionsDTO struct {
+	Operate bool `json:"operate"`
+	Delete  bool `json:"delete"`
+}
+
+type UpstreamTLSDTO struct {
+	Verify     bool   `json:"verify"`
+	CAFile     string `json:"caFile,omitempty"`
+	ServerName string `json:"serverName,omitempty"`
+	CertFile   string `json:"certFile,omitempty"`
+	KeyFile    string `json:"keyFile,omitempty"`
+}
+
+func (d *UpstreamTLSDTO) toConfig() *config.UpstreamTLSConfig {
+	if d == nil {
+		return nil
+	}
+	verify := d.Verify
+	return &config.UpstreamTLSConfig{
+		Verify:     &verify,
+		CAFile:     d.CAFile,
+		ServerName: d.ServerName,
+		CertFile:   d.CertFile,
+		KeyFile:    d.KeyFile,
+	}
+}
+
+type UpstreamDTO struct {
+	URL       string `json:"url"`
+	Container string `json:"container,omitempty"`
+	Up        bool   `json:"up"`
+	Ejected   bool   `json:"ejected"`
+	Active    int64  `json:"active"`
 }
 
 type SystemStatusDTO struct {
 	ListenAddr         string `json:"listenAddr"`
 	IdleReaperInterval string `json:"idleReaperInterval"`
+	LogLevel           string `json:"logLevel"`
+	LogFormat          string `json:"logFormat"`
 }
 
 type DockerPortDTO struct {
@@ -99,13 +164,13 @@ func parseHHMM(s string) int {
 	}
 	parts := strings.Split(s, ":")
 	if len(parts) != 2 {
-		log.Printf("invalid time format %q, expected HH:MM", s)
+		slog.Warn("invalid time format, expected HH:MM", "value", s)
 		return 0
 	}
 	h, err1 := strconv.Atoi(parts[0])
 	m, err2 := strconv.Atoi(parts[1])
 	if err1 != nil || err2 != nil || h < 0 || h > 23 || m < 0 || m > 59 {
-		log.Printf("invalid time value %q, expected HH:MM", s)
+		slog.Warn("invalid time value, expected HH:MM", "value", s)
 		return 0
 	}
 	return h*60 + m
@@ -154,11 +219,77 @@ func ParseSchedule(sc *config.ScheduleConfig, mode string) *ServiceSchedule {
 	return &m
 }
 
+type serviceSettings struct {
+	cfg      config.ServiceConfig
+	pool     *UpstreamPool
+	schedule *ServiceSchedule
+}
+
+func newServiceState(cfg config.ServiceConfig, pool *UpstreamPool) *ServiceState {
+	s := &ServiceState{LastActivity: time.Now()}
+	s.settings.Store(&serviceSettings{cfg: cfg, pool: pool, schedule: ParseSchedule(cfg.Schedule, cfg.Mode)})
+	return s
+}
+
+// Config returns the current settings. They must not be modified; use
+// update instead.
+func (s *ServiceState) Config() *config.ServiceConfig {
+	return &s.settings.Load().cfg
+}
+
+func (s *ServiceState) Pool() *UpstreamPool {
+	return s.settings.Load().pool
+}
+
+// Schedule is nil for services without one.
+func (s *ServiceState) Schedule() *ServiceSchedule {
+	return s.settings.Load().schedule
+}
+
+// update replaces the settings with what fn makes of a copy of them, and
+// the upstream pool with the one newPool returns, if any. The copy fn gets
+// becomes the new snapshot. When fn or newPool fails nothing is changed.
+// Once replaced, the old pool drops its idle connections; requests still
+// using it finish normally.
+func (s *ServiceState) update(fn func(cfg *config.ServiceConfig) error, newPool func(cfg config.ServiceConfig) (*UpstreamPool, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.settings.Load()
+	next := &serviceSettings{cfg: old.cfg, pool: old.pool}
+	if err := fn(&next.cfg); err != nil {
+		return err
+	}
+	if newPool != nil {
+		p, err := newPool(next.cfg)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			next.pool = p
+		}
+	}
+	next.schedule = ParseSchedule(next.cfg.Schedule, next.cfg.Mode)
+
+	s.settings.Store(next)
+	// The new settings may fix what made the scheduled start fail.
+	s.sched.reset()
+	if next.pool != old.pool {
+		old.pool.Close()
+	}
+	return nil
+}
+
 func (s *ServiceState) ShouldBeUp(now time.Time) bool {
-	if s.Schedule == nil {
+	return s.Schedule().ShouldBeUp(now)
+}
+
+// ShouldBeUp reports whether now is within the schedule; it is false
+// without one.
+func (sch *ServiceSchedule) ShouldBeUp(now time.Time) bool {
+	if sch == nil {
 		return false
 	}
-	sch := s.Schedule
 
 	if len(sch.Days) > 0 && !sch.Days[now.Weekday()] {
 		return false
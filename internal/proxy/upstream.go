@@ -0,0 +1,371 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"conslee/internal/config"
+)
+
+// Load balancing
+
+const (
+	LBRoundRobin = "round_robin"
+	LBLeastConn  = "least_conn"
+
+	defaultMaxFails    = 1
+	defaultFailTimeout = 10 * time.Second
+)
+
+// Upstream is a single backend target of a service. When Container is set the
+// upstream is a replica that Conslee starts and stops on its own.
+type Upstream struct {
+	URL       *url.URL
+	Raw       string
+	Socket    string // unix socket path for unix:// targets
+	Container string
+
+	active atomic.Int64
+
+	proxyOnce sync.Once
+	proxy     *httputil.ReverseProxy
+
+	mu           sync.Mutex
+	up           bool
+	starting     bool
+	fails        int
+	ejectedUntil time.Time
+}
+
+func (u *Upstream) Active() int64 {
+	return u.active.Load()
+}
+
+func (u *Upstream) IsUp() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.up
+}
+
+func (u *Upstream) setUp(up bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.starting {
+		return
+	}
+	u.up = up
+}
+
+func (u *Upstream) ejected(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return now.Before(u.ejectedUntil)
+}
+
+type UpstreamPool struct {
+	mu        sync.Mutex
+	upstreams []*Upstream
+	next      uint64
+
+	service     string
+	policy      string
+	maxFails    int
+	failTimeout time.Duration
+	transport   *http.Transport
+	sockets     map[string]string // dial address -> unix socket path
+}
+
+func NewUpstreamPool(sc config.ServiceConfig) (*UpstreamPool, error) {
+	raw := make([]string, 0, 1+len(sc.TargetURLs))
+	if sc.TargetURL != "" {
+		raw = append(raw, sc.TargetURL)
+	}
+	raw = append(raw, sc.TargetURLs...)
+
+	if len(sc.ReplicaContainers) > len(raw) {
+		return nil, fmt.Errorf("service %s has more replica containers than targets", sc.Name)
+	}
+
+	tlsCfg, err := newUpstreamTLSConfig(sc.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("service %s tls: %w", sc.Name, err)
+	}
+
+	p := &UpstreamPool{
+		service:     sc.Name,
+		policy:      sc.LoadBalancer,
+		maxFails:    sc.MaxFails,
+		failTimeout: sc.FailTimeout,
+		sockets:     map[string]string{},
+	}
+	p.transport = newUpstreamTransport(sc.Transport, tlsCfg, p.sockets)
+	if p.maxFails <= 0 {
+		p.maxFails = defaultMaxFails
+	}
+	if p.failTimeout <= 0 {
+		p.failTimeout = defaultFailTimeout
+	}
+
+	for i, r := range raw {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		u, socket, err := parseTarget(r)
+		if err != nil {
+			return nil, fmt.Errorf("parse target %q: %w", r, err)
+		}
+		if socket != "" {
+			// Give each socket its own synthetic host so the transport keeps
+			// a separate connection pool per socket.
+			u.Host = fmt.Sprintf("unix-%d", i)
+			p.sockets[u.Host+":80"] = socket
+		}
+		up := &Upstream{URL: u, Raw: r, Socket: socket, up: true}
+		if i < len(sc.ReplicaContainers) && sc.ReplicaContainers[i] != "" {
+			up.Container = sc.ReplicaContainers[i]
+			up.up = false
+		}
+		p.upstreams = append(p.upstreams, up)
+	}
+
+	return p, nil
+}
+
+// parseTarget parses a target URL. Besides http(s) URLs it accepts
+// unix:///path/to.sock with an optional HTTP base path appended after a
+// colon, e.g. unix:///run/app.sock:/api.
+func parseTarget(raw string) (*url.URL, string, error) {
+	rest, ok := strings.CutPrefix(raw, "unix://")
+	if !ok {
+		u, err := url.Parse(raw)
+		return u, "", err
+	}
+
+	socket, path, _ := strings.Cut(rest, ":")
+	if socket == "" || !strings.HasPrefix(socket, "/") {
+		return nil, "", fmt.Errorf("unix socket path must be absolute")
+	}
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return nil, "", fmt.Errorf("http path after socket must start with /")
+	}
+	return &url.URL{Scheme: "http", Path: path}, socket, nil
+}
+
+func ValidLoadBalancer(policy string) bool {
+	switch policy {
+	case "", LBRoundRobin, LBLeastConn:
+		return true
+	}
+	return false
+}
+
+func (p *UpstreamPool) All() []*Upstream {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Upstream(nil), p.upstreams...)
+}
+
+func (p *UpstreamPool) Len() int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.upstreams)
+}
+
+// Has reports whether the pool contains an upstream at the given scheme and
+// host.
+func (p *UpstreamPool) Has(scheme, host string) bool {
+	for _, u := range p.All() {
+		if strings.EqualFold(u.URL.Scheme, scheme) && strings.EqualFold(u.URL.Host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *UpstreamPool) Replicas() []*Upstream {
+	var out []*Upstream
+	for _, u := range p.All() {
+		if u.Container != "" {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// Pick selects an upstream according to the pool policy. Ejected upstreams are
+// skipped unless nothing else is available, so a fully ejected pool still
+// gets traffic rather than failing outright.
+func (p *UpstreamPool) Pick() *Upstream {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.upstreams) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var healthy, up []*Upstream
+	for _, u := range p.upstreams {
+		if !u.IsUp() {
+			continue
+		}
+		up = append(up, u)
+		if !u.ejected(now) {
+			healthy = append(healthy, u)
+		}
+	}
+
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = up
+	}
+	if len(candidates) == 0 {
+		candidates = p.upstreams
+	}
+
+	start := int(p.next % uint64(len(candidates)))
+	p.next++
+
+	if p.policy != LBLeastConn {
+		return candidates[start]
+	}
+
+	best := candidates[start]
+	for i := 1; i < len(candidates); i++ {
+		c := candidates[(start+i)%len(candidates)]
+		if c.Active() < best.Active() {
+			best = c
+		}
+	}
+	return best
+}
+
+// ReportFailure records a failed round-trip and ejects the upstream once it
+// has failed maxFails times in a row.
+func (p *UpstreamPool) ReportFailure(u *Upstream) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.fails++
+	if u.fails < p.maxFails {
+		return false
+	}
+	u.fails = 0
+	u.ejectedUntil = time.Now().Add(p.failTimeout)
+	return true
+}
+
+func (p *UpstreamPool) ReportSuccess(u *Upstream) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.fails = 0
+}
+
+// ScaleUpCandidate returns a stopped replica to start when the average number
+// of in-flight requests per running replica reaches threshold. The returned
+// upstream is marked as starting so concurrent callers don't pick it twice.
+func (p *UpstreamPool) ScaleUpCandidate(threshold int) *Upstream {
+	if p == nil || threshold <= 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var running int
+	var inflight int64
+	var stopped *Upstream
+	for _, u := range p.upstreams {
+		if u.Container == "" {
+			continue
+		}
+		u.mu.Lock()
+		switch {
+		case u.starting:
+			u.mu.Unlock()
+			return nil
+		case u.up:
+			running++
+			inflight += u.active.Load()
+		case stopped == nil:
+			stopped = u
+		}
+		u.mu.Unlock()
+	}
+
+	if stopped == nil || running == 0 {
+		return nil
+	}
+	if inflight < int64(threshold*running) {
+		return nil
+	}
+
+	stopped.mu.Lock()
+	stopped.starting = true
+	stopped.mu.Unlock()
+	return stopped
+}
+
+func (u *Upstream) finishStarting(up bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.starting = false
+	u.up = up
+}
+
+// Container helpers
+
+// sharedContainers returns the service containers that are not bound to a
+// replica and therefore always start together with the service.
+func (s *ServiceState) sharedContainers() []string {
+	cfg := s.Config()
+	names := cfg.Containers
+	if len(names) == 0 && cfg.ContainerName != "" {
+		names = []string{cfg.ContainerName}
+	}
+	replicas := map[string]bool{}
+	for _, n := range cfg.ReplicaContainers {
+		replicas[n] = true
+	}
+	var out []string
+	for _, n := range names {
+		if !replicas[n] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// ContainerNames returns every container of the service, replicas included.
+func (s *ServiceState) ContainerNames() []string {
+	out := s.sharedContainers()
+	for _, n := range s.Config().ReplicaContainers {
+		if n != "" {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func (s *ServiceState) minReplicas() int {
+	n := len(s.Pool().Replicas())
+	cfg := s.Config()
+	if cfg.MinReplicas > 0 && cfg.MinReplicas < n {
+		return cfg.MinReplicas
+	}
+	return n
+}
@@ -0,0 +1,294 @@
+package proxy
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"conslee/internal/auth"
+	"conslee/internal/usage"
+)
+
+// Usage accounting and savings report
+
+const (
+	usageInterval      = time.Minute
+	usageFlushInterval = 15 * time.Minute
+	// maxUsageGap caps the time one sample accounts for, so that time the
+	// host was suspended is not counted.
+	maxUsageGap = 2 * usageInterval
+
+	defaultReportRange = 7 * 24 * time.Hour
+)
+
+// TrackUsage samples which services are running, and the resource usage of
+// those that are, until ctx is done.
+func (c *Conslee) TrackUsage(ctx context.Context) {
+	ticker := time.NewTicker(usageInterval)
+	defer ticker.Stop()
+	flush := time.NewTicker(usageFlushInterval)
+	defer flush.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case now := <-ticker.C:
+			c.sampleUsage(ctx, now, min(now.Sub(last), maxUsageGap))
+			last = now
+		case <-flush.C:
+			c.FlushUsage()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// FlushUsage writes the collected usage to disk; it is called on shutdown.
+func (c *Conslee) FlushUsage() {
+	if err := c.usage.Flush(); err != nil {
+		slog.Error("write usage log", "err", err)
+	}
+}
+
+// sampleUsage accounts elapsed to every enabled service. Stats take about a
+// second per container, so services are sampled concurrently.
+func (c *Conslee) sampleUsage(ctx context.Context, now time.Time, elapsed time.Duration) {
+	var wg sync.WaitGroup
+	for _, svc := range c.reg.All() {
+		cfg := svc.Config()
+		if cfg.Disabled {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, err := c.measure(ctx, svc, elapsed.Seconds())
+			if err != nil {
+				slog.Warn("sample usage", "service", cfg.Name, "err", err)
+				return
+			}
+			b.Hour = now
+			c.usage.Add(b)
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *Conslee) measure(ctx context.Context, svc *ServiceState, seconds float64) (usage.Bucket, error) {
+	cfg := svc.Config()
+	b := usage.Bucket{Service: cfg.Name}
+	running, err := isRunning(ctx, c.rt, svc)
+	if err != nil {
+		return b, err
+	}
+	if !running {
+		b.StoppedSeconds = seconds
+		return b, nil
+	}
+	b.RunningSeconds = seconds
+
+	var cpu float64
+	var mem uint64
+	for _, name := range svc.ContainerNames() {
+		if st, err := c.rt.Inspect(ctx, name); err != nil || !st.Running {
+			continue
+		}
+		s, err := c.rt.Stats(ctx, name)
+		if err != nil {
+			// The running time still counts; only the sample is lost.
+			slog.Debug("container stats", "service", cfg.Name, "container", name, "err", err)
+			return b, nil
+		}
+		cpu += s.CPUCores
+		mem += s.MemoryBytes
+	}
+	b.SampledSeconds = seconds
+	b.CPUSeconds = cpu * seconds
+	b.MemoryByteSeconds = float64(mem) * seconds
+	return b, nil
+}
+
+// recordWake counts a wake in the usage of the service.
+func (c *Conslee) recordWake(service string) {
+	c.usage.Add(usage.Bucket{Hour: time.Now(), Service: service, Wakes: 1})
+}
+
+type ServiceSavingsDTO struct {
+	Service            string  `json:"service"`
+	RunningHours       float64 `json:"runningHours"`
+	StoppedHours       float64 `json:"stoppedHours"`
+	UptimePercent      float64 `json:"uptimePercent"`
+	Wakes              int     `json:"wakes"`
+	AvgCPUCores        float64 `json:"avgCpuCores"`
+	AvgMemoryMB        float64 `json:"avgMemoryMb"`
+	CPUCoreHoursUsed   float64 `json:"cpuCoreHoursUsed"`
+	CPUCoreHoursSaved  float64 `json:"cpuCoreHoursSaved"`
+	MemoryGBHoursUsed  float64 `json:"memoryGbHoursUsed"`
+	MemoryGBHoursSaved float64 `json:"memoryGbHoursSaved"`
+}
+
+type SavingsReportDTO struct {
+	From     time.Time           `json:"from"`
+	To       time.Time           `json:"to"`
+	Services []ServiceSavingsDTO `json:"services"`
+	// Total sums the services; its averages are those of all services
+	// running at once.
+	Total ServiceSavingsDTO `json:"total"`
+}
+
+// savings estimates what a service would have used while stopped from its
+// average usage while running.
+func savings(b usage.Bucket) ServiceSavingsDTO {
+	d := ServiceSavingsDTO{
+		Service:      b.Service,
+		RunningHours: b.RunningSeconds / 3600,
+		StoppedHours: b.StoppedSeconds / 3600,
+		Wakes:        b.Wakes,
+	}
+	if total := b.RunningSeconds + b.StoppedSeconds; total > 0 {
+		d.UptimePercent = 100 * b.RunningSeconds / total
+	}
+	if b.SampledSeconds > 0 {
+		d.AvgCPUCores = b.CPUSeconds / b.SampledSeconds
+		d.AvgMemoryMB = b.MemoryByteSeconds / b.SampledSeconds / (1 << 20)
+	}
+	d.CPUCoreHoursUsed = d.AvgCPUCores * d.RunningHours
+	d.CPUCoreHoursSaved = d.AvgCPUCores * d.StoppedHours
+	d.MemoryGBHoursUsed = d.AvgMemoryMB / 1024 * d.RunningHours
+	d.MemoryGBHoursSaved = d.AvgMemoryMB / 1024 * d.StoppedHours
+	return d
+}
+
+// parseReportTime accepts RFC 3339 or a date. A date as the end of the
+// range includes that day.
+func parseReportTime(s string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// GET /api/reports/savings?from=&to=&format=csv
+func (c *Conslee) HandleSavingsReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	to := time.Now().UTC()
+	if v := q.Get("to"); v != "" {
+		t, err := parseReportTime(v, true)
+		if err != nil {
+			http.Error(w, "invalid to, expected RFC 3339 or YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-defaultReportRange)
+	if v := q.Get("from"); v != "" {
+		t, err := parseReportTime(v, false)
+		if err != nil {
+			http.Error(w, "invalid from, expected RFC 3339 or YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "invalid format, expected json or csv", http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := c.usage.Query(from, to)
+	if err != nil {
+		slog.Error("read usage log", "err", err)
+		http.Error(w, "cannot read usage log", http.StatusInternalServerError)
+		return
+	}
+
+	// As in the audit log, services that no longer exist are shown to
+	// admins only.
+	p := auth.FromContext(r.Context())
+	report := SavingsReportDTO{From: from, To: to, Services: []ServiceSavingsDTO{}}
+	for _, b := range buckets {
+		if !p.HasRole(auth.RoleAdmin) {
+			svc, ok := c.reg.GetByName(b.Service)
+			if !ok || !p.CanView(*svc.Config()) {
+				continue
+			}
+		}
+		d := savings(b)
+		report.Services = append(report.Services, d)
+
+		t := &report.Total
+		t.RunningHours += d.RunningHours
+		t.StoppedHours += d.StoppedHours
+		t.Wakes += d.Wakes
+		t.AvgCPUCores += d.AvgCPUCores
+		t.AvgMemoryMB += d.AvgMemoryMB
+		t.CPUCoreHoursUsed += d.CPUCoreHoursUsed
+		t.CPUCoreHoursSaved += d.CPUCoreHoursSaved
+		t.MemoryGBHoursUsed += d.MemoryGBHoursUsed
+		t.MemoryGBHoursSaved += d.MemoryGBHoursSaved
+	}
+	if total := report.Total.RunningHours + report.Total.StoppedHours; total > 0 {
+		report.Total.UptimePercent = 100 * report.Total.RunningHours / total
+	}
+
+	if format == "csv" {
+		writeSavingsCSV(w, &report)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// csvText keeps spreadsheets from reading a cell as a formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func writeSavingsCSV(w http.ResponseWriter, report *SavingsReportDTO) {
+	name := "conslee-savings-" + report.From.Format("20060102") + "-" + report.To.Format("20060102") + ".csv"
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	row := func(d ServiceSavingsDTO) []string {
+		return []string{
+			csvText(d.Service), f(d.RunningHours), f(d.StoppedHours), f(d.UptimePercent), strconv.Itoa(d.Wakes),
+			f(d.AvgCPUCores), f(d.AvgMemoryMB),
+			f(d.CPUCoreHoursUsed), f(d.CPUCoreHoursSaved), f(d.MemoryGBHoursUsed), f(d.MemoryGBHoursSaved),
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{
+		"service", "running_hours", "stopped_hours", "uptime_percent", "wakes",
+		"avg_cpu_cores", "avg_memory_mb",
+		"cpu_core_hours_used", "cpu_core_hours_saved", "memory_gb_hours_used", "memory_gb_hours_saved",
+	})
+	for _, d := range report.Services {
+		_ = cw.Write(row(d))
+	}
+	total := report.Total
+	total.Service = "total"
+	_ = cw.Write(row(total))
+	cw.Flush()
+}
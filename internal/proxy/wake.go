@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"conslee/internal/config"
+)
+
+// Wake rules
+
+const defaultWakeResponseBody = "service is sleeping\n"
+
+type wakeState struct {
+	once       sync.Once
+	cidrs      ipSet
+	suppressed atomic.Int64
+}
+
+// SuppressedWakes is the number of requests that would have started the
+// service but were refused by its wake rules.
+func (s *ServiceState) SuppressedWakes() int64 {
+	return s.wake.suppressed.Load()
+}
+
+func matchPath(patterns []string, p string) bool {
+	for _, pat := range patterns {
+		if prefix, ok := strings.CutSuffix(pat, "*"); ok {
+			if strings.HasPrefix(p, prefix) {
+				return true
+			}
+		} else if p == pat {
+			return true
+		}
+	}
+	return false
+}
+
+func matchUserAgent(patterns []string, ua string) bool {
+	ua = strings.ToLower(ua)
+	for _, pat := range patterns {
+		if pat != "" && strings.Contains(ua, strings.ToLower(pat)) {
+			return true
+		}
+	}
+	return false
+}
+
+// canWake reports whether the request may start the service.
+func (s *ServiceState) canWake(r *http.Request) bool {
+	wc := s.Config().Wake
+	if wc == nil {
+		return true
+	}
+
+	p := r.URL.Path
+	if len(wc.Paths) > 0 && !matchPath(wc.Paths, p) {
+		return false
+	}
+	if matchPath(wc.IgnorePaths, p) {
+		return false
+	}
+
+	if len(wc.Methods) > 0 {
+		ok := false
+		for _, m := range wc.Methods {
+			if strings.EqualFold(m, r.Method) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	ua := r.UserAgent()
+	if len(wc.UserAgents) > 0 && !matchUserAgent(wc.UserAgents, ua) {
+		return false
+	}
+	if matchUserAgent(wc.IgnoreUserAgents, ua) {
+		return false
+	}
+
+	if len(wc.CIDRs) > 0 {
+		s.wake.once.Do(func() {
+			s.wake.cidrs = newIPSet(wc.CIDRs)
+		})
+		if !s.wake.cidrs.contains(getClientIP(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// serveWithoutWake handles a request that may not start the service: it is
+// proxied when the service already runs and answered with the configured
+// static response otherwise. It returns false when the request should be
+// proxied.
+func (c *Conslee) serveWithoutWake(ctx context.Context, w http.ResponseWriter, svc *ServiceState) bool {
+	cfg := svc.Config()
+	running, err := isRunning(ctx, c.rt, svc)
+	if err != nil {
+		slog.Warn("inspect service", "service", cfg.Name, "action", "wake", "err", err)
+	}
+	if running {
+		return false
+	}
+
+	if n := svc.wake.suppressed.Add(1); n == 1 || n%100 == 0 {
+		slog.Info("wake-ups suppressed by wake rules", "service", cfg.Name, "action", "wake", "count", n)
+	}
+	writeWakeResponse(w, cfg.Wake.Response, svc)
+	return true
+}
+
+func writeWakeResponse(w http.ResponseWriter, rc *config.WakeResponseConfig, svc *ServiceState) {
+	status := http.StatusServiceUnavailable
+	contentType := "text/plain; charset=utf-8"
+	body := defaultWakeResponseBody
+	if rc != nil {
+		if rc.Status != 0 {
+			status = rc.Status
+		}
+		if rc.ContentType != "" {
+			contentType = rc.ContentType
+		}
+		if rc.Body != "" {
+			body = rc.Body
+		}
+	}
+
+	cfg := svc.Config()
+	w.Header().Set(probeSignatureHeader, cfg.Name)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-store")
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(int(cfg.StartupTimeout.Seconds())+1))
+	}
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, body)
+}
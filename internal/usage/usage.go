@@ -0,0 +1,253 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Running time and resource usage of services
+
+// Retention is how long usage is kept.
+const Retention = 400 * 24 * time.Hour
+
+// Bucket is the usage of one service in one hour. Buckets are additive: the
+// file may hold several for the same hour, which are summed when read.
+type Bucket struct {
+	Hour    time.Time `json:"hour"`
+	Service string    `json:"service"`
+
+	RunningSeconds float64 `json:"running"`
+	StoppedSeconds float64 `json:"stopped"`
+	Wakes          int     `json:"wakes,omitempty"`
+
+	// SampledSeconds is the running time covered by resource samples, which
+	// CPUSeconds and MemoryByteSeconds are the integrals over.
+	SampledSeconds    float64 `json:"sampled,omitempty"`
+	CPUSeconds        float64 `json:"cpu,omitempty"`
+	MemoryByteSeconds float64 `json:"memory,omitempty"`
+}
+
+func (b *Bucket) add(o Bucket) {
+	b.RunningSeconds += o.RunningSeconds
+	b.StoppedSeconds += o.StoppedSeconds
+	b.Wakes += o.Wakes
+	b.SampledSeconds += o.SampledSeconds
+	b.CPUSeconds += o.CPUSeconds
+	b.MemoryByteSeconds += o.MemoryByteSeconds
+}
+
+type key struct {
+	hour    time.Time
+	service string
+}
+
+// Store collects usage in memory and appends it to a file of JSON lines on
+// Flush. Once the file has grown to twice the number of buckets it held
+// after the last compaction, it is rewritten with one line per bucket and
+// without the buckets older than Retention. A nil *Store discards usage.
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	pending map[key]*Bucket
+	kept    int // lines in the file after the last compaction
+	lines   int // lines in the file
+}
+
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create usage directory: %w", err)
+	}
+	s := &Store{path: path, pending: map[key]*Bucket{}}
+	if err := s.compact(time.Now()); err != nil {
+		return nil, fmt.Errorf("compact usage log: %w", err)
+	}
+	return s, nil
+}
+
+// Add adds b to the bucket of its service and hour; b.Hour may be any time
+// within the hour.
+func (s *Store) Add(b Bucket) {
+	if s == nil {
+		return
+	}
+	b.Hour = b.Hour.UTC().Truncate(time.Hour)
+	k := key{b.Hour, b.Service}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.pending[k]; ok {
+		p.add(b)
+		return
+	}
+	s.pending[k] = &b
+}
+
+// Flush writes the usage collected since the last flush.
+func (s *Store) Flush() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for _, b := range s.pending {
+		line, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.lines += len(s.pending)
+	clear(s.pending)
+	if s.lines > 2*s.kept {
+		return s.compact(time.Now())
+	}
+	return nil
+}
+
+// compact rewrites the file with the buckets of each hour and service
+// summed, dropping those older than Retention. It is called with s.mu held
+// or before s is shared.
+func (s *Store) compact(now time.Time) error {
+	cutoff := now.Add(-Retention)
+	buckets := map[key]*Bucket{}
+	err := s.scan(func(b Bucket) {
+		if b.Hour.Before(cutoff) {
+			return
+		}
+		b.Hour = b.Hour.UTC()
+		k := key{b.Hour, b.Service}
+		if t, ok := buckets[k]; ok {
+			t.add(b)
+			return
+		}
+		buckets[k] = &b
+	})
+	if err != nil {
+		return err
+	}
+
+	list := make([]*Bucket, 0, len(buckets))
+	for _, b := range buckets {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Hour.Equal(list[j].Hour) {
+			return list[i].Hour.Before(list[j].Hour)
+		}
+		return list[i].Service < list[j].Service
+	})
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".usage-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, b := range list {
+		if err := enc.Encode(b); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.kept, s.lines = len(list), len(list)
+	return nil
+}
+
+// scan calls fn with every bucket in the file.
+func (s *Store) scan(fn func(Bucket)) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		var b Bucket
+		if err := json.Unmarshal(sc.Bytes(), &b); err != nil {
+			continue
+		}
+		fn(b)
+	}
+	return sc.Err()
+}
+
+// Query returns the usage per service of the hours starting in [from, to),
+// including what has not been flushed yet. Hour is left zero.
+func (s *Store) Query(from, to time.Time) ([]Bucket, error) {
+	if s == nil {
+		return nil, nil
+	}
+	totals := map[string]*Bucket{}
+	include := func(b Bucket) {
+		if b.Hour.Before(from.Truncate(time.Hour)) || !b.Hour.Before(to) {
+			return
+		}
+		t, ok := totals[b.Service]
+		if !ok {
+			t = &Bucket{Service: b.Service}
+			totals[b.Service] = t
+		}
+		t.add(b)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.pending {
+		include(*b)
+	}
+	if err := s.scan(include); err != nil {
+		return nil, err
+	}
+	return collect(totals), nil
+}
+
+func collect(totals map[string]*Bucket) []Bucket {
+	out := make([]Bucket, 0, len(totals))
+	for _, t := range totals {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Service < out[j].Service })
+	return out
+}
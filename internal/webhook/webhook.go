@@ -0,0 +1,248 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"text/template"
+	"time"
+
+	"conslee/internal/config"
+	"conslee/internal/events"
+)
+
+// Outgoing webhooks
+
+const (
+	SignatureHeader = "X-Conslee-Signature"
+	EventHeader     = "X-Conslee-Event"
+	DeliveryHeader  = "X-Conslee-Delivery"
+
+	defaultMaxRetries = 5
+	defaultTimeout    = 10 * time.Second
+	firstBackoff      = time.Second
+	maxBackoff        = 5 * time.Minute
+	// queueSize is how many events may wait for a slow sink before new
+	// ones are dropped.
+	queueSize = 100
+)
+
+// DefaultEvents are sent to webhooks that do not list any.
+var DefaultEvents = []string{events.TypeFailed, events.TypeIdleStopped, events.TypeScheduleStopped}
+
+// Payload is what templates are rendered with: the event and a message
+// for chat services.
+type Payload struct {
+	events.Event
+	Message string
+}
+
+var funcs = template.FuncMap{
+	// json quotes a value for use inside a JSON template.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+type sink struct {
+	cfg     config.WebhookConfig
+	tmpl    *template.Template
+	events  []string
+	retries int
+	client  *http.Client
+	queue   chan events.Event
+}
+
+// Dispatcher delivers events to the configured webhooks. Each webhook has
+// its own queue, so a slow or failing one does not hold up the others.
+type Dispatcher struct {
+	sinks []*sink
+}
+
+func New(cfgs []config.WebhookConfig) (*Dispatcher, error) {
+	d := &Dispatcher{}
+	for _, wc := range cfgs {
+		s := &sink{
+			cfg:     wc,
+			events:  wc.Events,
+			retries: defaultMaxRetries,
+			queue:   make(chan events.Event, queueSize),
+		}
+		if len(s.events) == 0 {
+			s.events = DefaultEvents
+		}
+		if wc.MaxRetries != nil {
+			s.retries = *wc.MaxRetries
+		}
+		timeout := wc.Timeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+		s.client = &http.Client{Timeout: timeout}
+		if wc.Template != "" {
+			t, err := template.New(wc.Name).Funcs(funcs).Option("missingkey=error").Parse(wc.Template)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s: parse template: %w", wc.Name, err)
+			}
+			s.tmpl = t
+		}
+		d.sinks = append(d.sinks, s)
+	}
+	return d, nil
+}
+
+// Run delivers the events published on bus until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, bus *events.Bus) {
+	if len(d.sinks) == 0 {
+		return
+	}
+	for _, s := range d.sinks {
+		go s.run(ctx)
+	}
+	bus.Follow(ctx, d.dispatch)
+}
+
+func (d *Dispatcher) dispatch(e events.Event) {
+	for _, s := range d.sinks {
+		if !s.wants(e) {
+			continue
+		}
+		select {
+		case s.queue <- e:
+		default:
+			slog.Warn("webhook queue full, dropping event", "webhook", s.cfg.Name, "service", e.Service, "event", e.Type)
+		}
+	}
+}
+
+func (s *sink) wants(e events.Event) bool {
+	if !slices.Contains(s.events, "*") && !slices.Contains(s.events, e.Type) {
+		return false
+	}
+	return len(s.cfg.Services) == 0 || slices.Contains(s.cfg.Services, e.Service)
+}
+
+func (s *sink) run(ctx context.Context) {
+	for {
+		select {
+		case e := <-s.queue:
+			s.deliver(ctx, e)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver sends one event, retrying with exponential backoff on network
+// errors, 5xx and 429 responses.
+func (s *sink) deliver(ctx context.Context, e events.Event) {
+	body, err := s.render(e)
+	if err != nil {
+		slog.Error("render webhook payload", "webhook", s.cfg.Name, "service", e.Service, "event", e.Type, "err", err)
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, wait, err := s.post(ctx, e, body)
+		if err == nil {
+			slog.Debug("webhook delivered", "webhook", s.cfg.Name, "service", e.Service, "event", e.Type)
+			return
+		}
+		if !retry || attempt >= s.retries {
+			slog.Error("webhook delivery failed", "webhook", s.cfg.Name, "service", e.Service, "event", e.Type, "attempts", attempt+1, "err", err)
+			return
+		}
+		if wait <= 0 {
+			wait = backoff(attempt)
+		}
+		slog.Warn("webhook delivery failed, retrying", "webhook", s.cfg.Name, "service", e.Service, "event", e.Type, "retry_in", wait, "err", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func backoff(attempt int) time.Duration {
+	d := firstBackoff << attempt
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+func (s *sink) post(ctx context.Context, e events.Event, body []byte) (retry bool, wait time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Conslee-Webhook")
+	req.Header.Set(EventHeader, e.Type)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(e.ID, 10))
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if s.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(s.cfg.Secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, 0, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			wait = min(time.Duration(secs)*time.Second, maxBackoff)
+		}
+		return true, wait, fmt.Errorf("status %d", resp.StatusCode)
+	case resp.StatusCode >= 500:
+		return true, 0, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return false, 0, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
+
+// Sign returns the signature header value: "sha256=" and the hex HMAC of
+// the body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *sink) render(e events.Event) ([]byte, error) {
+	p := Payload{Event: e, Message: e.Message()}
+	if s.tmpl == nil {
+		return json.Marshal(struct {
+			events.Event
+			Message string `json:"message"`
+		}{e, p.Message})
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.Execute(&buf, p); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("template output is not valid JSON")
+	}
+	return buf.Bytes(), nil
+}
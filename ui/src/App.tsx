@@ -14,13 +14,18 @@ import MainHeader from "./components/MainHeader";
 import { guessTargetFromSelectionImpl } from "./utils/guessTargetFromSelection"
 import ServiceList from "./components/ServiceList";
 import HelpPage from "./components/HelpPage";
+import AuditPage from "./components/AuditPage";
+import ReportsPage from "./components/ReportsPage";
 import { useI18n } from "./i18n/I18nContext";
 import { useServices } from "./hooks/useServices";
 import { useSystem } from "./hooks/useSystem";
 import { useContainers } from "./hooks/useContainers";
+import { apiFetch } from "./utils/api";
+import { useAuth } from "./auth/AuthContext";
 
 const App: React.FC = () => {
   const { t } = useI18n();
+  const { isAdmin } = useAuth();
 
   // Data hooks
   const { services, loading, refetch: fetchServices } = useServices();
@@ -63,9 +68,11 @@ const App: React.FC = () => {
     if (patch.idleReaperInterval !== undefined) {
       body.idleReaperInterval = patch.idleReaperInterval;
     }
+    if (patch.logLevel !== undefined) body.logLevel = patch.logLevel;
+    if (patch.logFormat !== undefined) body.logFormat = patch.logFormat;
 
     try {
-      await fetch("/api/system", {
+      await apiFetch("/api/system", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify(body),
@@ -117,14 +124,14 @@ const App: React.FC = () => {
     });
 
   const handleStart = async (name: string) => {
-    await fetch(`/api/services/${encodeURIComponent(name)}/start`, {
+    await apiFetch(`/api/services/${encodeURIComponent(name)}/start`, {
       method: "POST",
     });
     fetchServices();
   };
 
   const handleStop = async (name: string) => {
-    await fetch(`/api/services/${encodeURIComponent(name)}/stop`, {
+    await apiFetch(`/api/services/${encodeURIComponent(name)}/stop`, {
       method: "POST",
     });
     fetchServices();
@@ -132,7 +139,7 @@ const App: React.FC = () => {
 
   const handleDelete = async (name: string) => {
     if (!confirm(t("app.deleteConfirm", { name }))) return;
-    await fetch(`/api/services/${encodeURIComponent(name)}`, {
+    await apiFetch(`/api/services/${encodeURIComponent(name)}`, {
       method: "DELETE",
     });
     fetchServices();
@@ -154,7 +161,7 @@ const App: React.FC = () => {
   ) => {
     setSaving(true);
     try {
-      await fetch(`/api/services/${encodeURIComponent(svc.name)}/settings`, {
+      await apiFetch(`/api/services/${encodeURIComponent(svc.name)}/settings`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify(patch),
@@ -204,6 +211,7 @@ const App: React.FC = () => {
       <main className="main">
         <MainHeader
           loading={loading}
+          canManage={isAdmin}
           onShowCreate={() => setShowCreate(true)}
           onShowSystem={() => setShowSystem(true)}
           onToggleSidebar={() => setSidebarOpen(!sidebarOpen)}
@@ -211,6 +219,10 @@ const App: React.FC = () => {
 
         {tab === "help" ? (
           <HelpPage />
+        ) : tab === "audit" ? (
+          <AuditPage services={services.map((s) => s.name)} />
+        ) : tab === "reports" ? (
+          <ReportsPage />
         ) : (
           <ServiceList
             services={filtered}
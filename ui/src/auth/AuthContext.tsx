@@ -0,0 +1,100 @@
+import React, { createContext, useContext, useState, useEffect, useCallback, ReactNode } from "react";
+import LoginPage from "../components/LoginPage";
+import { apiFetch, continueURL, returnTo, UNAUTHORIZED_EVENT } from "../utils/api";
+
+export type Role = "viewer" | "operator" | "admin";
+
+export type AuthUser = {
+  name: string;
+  method: string;
+  role: Role;
+  groups?: string[];
+};
+
+interface AuthContextType {
+  enabled: boolean;
+  user: AuthUser | null;
+  isAdmin: boolean;
+  logout: () => Promise<void>;
+}
+
+const AuthContext = createContext<AuthContextType | undefined>(undefined);
+
+type AuthState = "loading" | "login" | "ready";
+
+/**
+ * Gate for the whole app: renders the login page until the management API
+ * accepts the caller, then provides the current user to the children.
+ */
+export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) => {
+  const [state, setState] = useState<AuthState>("loading");
+  const [enabled, setEnabled] = useState(false);
+  const [user, setUser] = useState<AuthUser | null>(null);
+  const [passwordLogin, setPasswordLogin] = useState(true);
+  const [oidc, setOidc] = useState<string | undefined>(undefined);
+
+  const refresh = useCallback(async () => {
+    try {
+      const res = await apiFetch("/api/auth/me");
+      if (!res.ok) {
+        throw new Error(`HTTP ${res.status}`);
+      }
+      const data = await res.json();
+      setEnabled(!!data.enabled);
+      setUser(data.user ?? null);
+      setPasswordLogin(data.passwordLogin ?? true);
+      setOidc(data.oidc || undefined);
+      const rd = returnTo();
+      if (data.enabled && data.authenticated && rd) {
+        window.location.href = continueURL(rd);
+        return;
+      }
+      setState(!data.enabled || data.authenticated ? "ready" : "login");
+    } catch (e) {
+      console.error("Failed to load auth state", e);
+      setState("login");
+    }
+  }, []);
+
+  useEffect(() => {
+    refresh();
+
+    const onUnauthorized = () => {
+      setUser(null);
+      setState("login");
+    };
+    window.addEventListener(UNAUTHORIZED_EVENT, onUnauthorized);
+    return () => window.removeEventListener(UNAUTHORIZED_EVENT, onUnauthorized);
+  }, [refresh]);
+
+  const logout = async () => {
+    try {
+      await apiFetch("/api/auth/logout", { method: "POST" });
+    } finally {
+      setUser(null);
+      setState("login");
+    }
+  };
+
+  if (state === "loading") {
+    return null;
+  }
+
+  if (state === "login") {
+    return <LoginPage passwordLogin={passwordLogin} oidc={oidc} onLoggedIn={refresh} />;
+  }
+
+  return (
+    <AuthContext.Provider value={{ enabled, user, isAdmin: !enabled || user?.role === "admin", logout }}>
+      {children}
+    </AuthContext.Provider>
+  );
+};
+
+export const useAuth = (): AuthContextType => {
+  const context = useContext(AuthContext);
+  if (!context) {
+    throw new Error("useAuth must be used within AuthProvider");
+  }
+  return context;
+};
@@ -0,0 +1,137 @@
+import React, { useState } from "react";
+import { useI18n } from "../i18n/I18nContext";
+import { useAudit } from "../hooks/useAudit";
+import type { AuditEntry } from "../types";
+
+type Props = {
+  services: string[];
+};
+
+const ACTIONS = [
+  "service.create",
+  "service.update",
+  "service.delete",
+  "service.start",
+  "service.stop",
+  "system.update",
+  "idle.stop",
+  "schedule.start",
+  "schedule.stop",
+];
+
+const formatTime = (iso: string) =>
+  new Date(iso).toLocaleString(undefined, {
+    year: "numeric",
+    month: "2-digit",
+    day: "2-digit",
+    hour: "2-digit",
+    minute: "2-digit",
+    second: "2-digit",
+    hour12: false,
+  });
+
+const formatValue = (v: unknown) => {
+  if (v === undefined || v === null) return "—";
+  if (typeof v === "string") return v;
+  return JSON.stringify(v);
+};
+
+const AuditRow: React.FC<{ entry: AuditEntry }> = ({ entry }) => {
+  const { t } = useI18n();
+  const [open, setOpen] = useState(false);
+  const changes = entry.changes ?? [];
+
+  return (
+    <>
+      <tr>
+        <td className="audit-time">{formatTime(entry.time)}</td>
+        <td>{entry.actor}</td>
+        <td>{t(`audit.actions.${entry.action}`)}</td>
+        <td>{entry.service || "—"}</td>
+        <td>
+          {entry.detail}
+          {changes.length > 0 && (
+            <button className="btn-ghost audit-toggle" onClick={() => setOpen(!open)}>
+              {t("audit.changes", { count: changes.length })}
+            </button>
+          )}
+        </td>
+      </tr>
+      {open && (
+        <tr className="audit-changes">
+          <td colSpan={5}>
+            <table>
+              <tbody>
+                {changes.map((c) => (
+                  <tr key={c.field}>
+                    <td><code>{c.field}</code></td>
+                    <td className="audit-before">{formatValue(c.before)}</td>
+                    <td className="audit-after">{formatValue(c.after)}</td>
+                  </tr>
+                ))}
+              </tbody>
+            </table>
+          </td>
+        </tr>
+      )}
+    </>
+  );
+};
+
+const AuditPage: React.FC<Props> = ({ services }) => {
+  const { t } = useI18n();
+  const [service, setService] = useState("");
+  const [actor, setActor] = useState("");
+  const [action, setAction] = useState("");
+  const { entries, loading } = useAudit({ service, actor: actor.trim(), action });
+
+  return (
+    <div className="audit-page">
+      <h1>{t("audit.title")}</h1>
+
+      <div className="audit-filters">
+        <select value={service} onChange={(e) => setService(e.target.value)}>
+          <option value="">{t("audit.allServices")}</option>
+          {services.map((name) => (
+            <option key={name} value={name}>{name}</option>
+          ))}
+        </select>
+        <select value={action} onChange={(e) => setAction(e.target.value)}>
+          <option value="">{t("audit.allActions")}</option>
+          {ACTIONS.map((a) => (
+            <option key={a} value={a}>{t(`audit.actions.${a}`)}</option>
+          ))}
+        </select>
+        <input
+          type="text"
+          placeholder={t("audit.actor")}
+          value={actor}
+          onChange={(e) => setActor(e.target.value)}
+        />
+      </div>
+
+      {!loading && entries.length === 0 ? (
+        <div className="empty-state">{t("audit.empty")}</div>
+      ) : (
+        <table className="audit-table">
+          <thead>
+            <tr>
+              <th>{t("audit.time")}</th>
+              <th>{t("audit.actor")}</th>
+              <th>{t("audit.action")}</th>
+              <th>{t("audit.service")}</th>
+              <th>{t("audit.details")}</th>
+            </tr>
+          </thead>
+          <tbody>
+            {entries.map((e, i) => (
+              <AuditRow key={`${e.time}-${i}`} entry={e} />
+            ))}
+          </tbody>
+        </table>
+      )}
+    </div>
+  );
+};
+
+export default AuditPage;
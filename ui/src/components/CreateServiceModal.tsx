@@ -8,6 +8,7 @@ import {
 } from "../utils/validation";
 import { useI18n } from "../i18n/I18nContext";
 import CustomDropdown from "./CustomDropdown";
+import { apiFetch } from "../utils/api";
 
 const WEEK_DAY_KEYS = ["mon", "tue", "wed", "thu", "fri", "sat", "sun"] as const;
 const ALL_WEEK_DAY_KEYS = WEEK_DAY_KEYS.slice();
@@ -620,7 +621,7 @@ const CreateServiceModal: React.FC<Props> = ({
               }
 
               try {
-                const res = await fetch("/api/services", {
+                const res = await apiFetch("/api/services", {
                   method: "POST",
                   headers: { "Content-Type": "application/json" },
                   body: JSON.stringify(body),
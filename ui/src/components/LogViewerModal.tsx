@@ -0,0 +1,140 @@
+import React, { useEffect, useRef, useState } from "react";
+import { createPortal } from "react-dom";
+import { useI18n } from "../i18n/I18nContext";
+import { apiFetch } from "../utils/api";
+
+type Props = {
+  service: string;
+  containers: string[];
+  onClose: () => void;
+};
+
+// Older output is dropped so a followed log does not grow without bound.
+const MAX_LINES = 5000;
+
+const SINCE_OPTIONS = ["", "15m", "1h", "6h", "24h"];
+
+const LogViewerModal: React.FC<Props> = ({ service, containers, onClose }) => {
+  const { t } = useI18n();
+  const [isClosing, setIsClosing] = useState(false);
+  const [container, setContainer] = useState(containers[0] ?? "");
+  const [since, setSince] = useState("");
+  const [follow, setFollow] = useState(true);
+  const [lines, setLines] = useState<string[]>([]);
+  // An empty error means the request itself failed.
+  const [error, setError] = useState<string | null>(null);
+  const [streaming, setStreaming] = useState(false);
+  const outputRef = useRef<HTMLPreElement>(null);
+  const stickToBottomRef = useRef(true);
+
+  useEffect(() => {
+    if (!container) return;
+    const abort = new AbortController();
+    setLines([]);
+    setError(null);
+
+    const load = async () => {
+      const params = new URLSearchParams({ container, follow: String(follow) });
+      if (since) params.set("since", since);
+      try {
+        const res = await apiFetch(
+          `/api/services/${encodeURIComponent(service)}/logs?${params.toString()}`,
+          { signal: abort.signal }
+        );
+        if (!res.ok || !res.body) {
+          setError((await res.text()).trim() || `HTTP ${res.status}`);
+          return;
+        }
+        setStreaming(true);
+        const reader = res.body.getReader();
+        const decoder = new TextDecoder();
+        let partial = "";
+        for (;;) {
+          const { done, value } = await reader.read();
+          if (done) break;
+          const text = partial + decoder.decode(value, { stream: true });
+          const parts = text.split("\n");
+          partial = parts.pop() ?? "";
+          if (parts.length > 0) {
+            setLines((prev) => prev.concat(parts).slice(-MAX_LINES));
+          }
+        }
+        if (partial) setLines((prev) => prev.concat(partial).slice(-MAX_LINES));
+      } catch (e) {
+        if (!abort.signal.aborted) {
+          console.error("Failed to load logs", e);
+          setError("");
+        }
+      } finally {
+        if (!abort.signal.aborted) setStreaming(false);
+      }
+    };
+    load();
+
+    return () => abort.abort();
+  }, [service, container, since, follow]);
+
+  // Keep the newest lines in view unless the user has scrolled up.
+  useEffect(() => {
+    const el = outputRef.current;
+    if (el && stickToBottomRef.current) el.scrollTop = el.scrollHeight;
+  }, [lines]);
+
+  const handleScroll = () => {
+    const el = outputRef.current;
+    if (!el) return;
+    stickToBottomRef.current = el.scrollHeight - el.scrollTop - el.clientHeight < 40;
+  };
+
+  const handleClose = () => {
+    setIsClosing(true);
+    setTimeout(() => {
+      onClose();
+    }, 300);
+  };
+
+  return createPortal(
+    <div className={`system-overlay ${isClosing ? "closing" : ""}`} onClick={handleClose}>
+      <div className="system-panel log-viewer" onClick={(e) => e.stopPropagation()}>
+        <h2>{t("logs.title", { name: service })}</h2>
+
+        <div className="log-viewer-controls">
+          {containers.length > 1 && (
+            <select value={container} onChange={(e) => setContainer(e.target.value)}>
+              {containers.map((c) => (
+                <option key={c} value={c}>{c}</option>
+              ))}
+            </select>
+          )}
+          <select value={since} onChange={(e) => setSince(e.target.value)}>
+            {SINCE_OPTIONS.map((s) => (
+              <option key={s} value={s}>{t(`logs.since.${s || "tail"}`)}</option>
+            ))}
+          </select>
+          <label className="log-viewer-follow">
+            <input type="checkbox" checked={follow} onChange={(e) => setFollow(e.target.checked)} />
+            {t("logs.follow")}
+          </label>
+          {streaming && follow && <span className="log-viewer-live">{t("logs.live")}</span>}
+        </div>
+
+        {error !== null ? (
+          <div className="log-viewer-error">{error || t("logs.error")}</div>
+        ) : (
+          <pre className="log-viewer-output" ref={outputRef} onScroll={handleScroll}>
+            {lines.length > 0 ? lines.join("\n") : streaming ? "" : t("logs.empty")}
+          </pre>
+        )}
+
+        <div className="system-footer">
+          <button className="btn btn-secondary" onClick={handleClose}>
+            {t("logs.close")}
+          </button>
+        </div>
+      </div>
+    </div>,
+    document.body
+  );
+};
+
+export default LogViewerModal;
@@ -0,0 +1,128 @@
+import React, { useState } from "react";
+import ConsleeLogo from "../assets/conslee-logo.svg";
+import { useI18n } from "../i18n/I18nContext";
+import { apiFetch, returnTo } from "../utils/api";
+
+type Props = {
+  passwordLogin: boolean;
+  oidc?: string;
+  onLoggedIn: () => void;
+};
+
+const SSO_ERRORS: Record<string, string> = {
+  denied: "auth.ssoDenied",
+  unavailable: "auth.ssoUnavailable",
+};
+
+/**
+ * Reads and removes the sso_error parameter the OIDC callback redirects with.
+ */
+function takeSsoError(): string | null {
+  const params = new URLSearchParams(window.location.search);
+  const reason = params.get("sso_error");
+  if (!reason) {
+    return null;
+  }
+  params.delete("sso_error");
+  const query = params.toString();
+  window.history.replaceState(null, "", window.location.pathname + (query ? `?${query}` : ""));
+  return SSO_ERRORS[reason] ?? "auth.ssoFailed";
+}
+
+const LoginPage: React.FC<Props> = ({ passwordLogin, oidc, onLoggedIn }) => {
+  const { t } = useI18n();
+  const [username, setUsername] = useState("");
+  const [password, setPassword] = useState("");
+  const [ssoError] = useState(takeSsoError);
+  const [error, setError] = useState<string | null>(null);
+  const rd = returnTo();
+  const ssoHref = "/api/auth/oidc/login" + (rd ? `?rd=${encodeURIComponent(rd)}` : "");
+  const [submitting, setSubmitting] = useState(false);
+
+  const theme = localStorage.getItem("theme") === "light" ? "light" : "dark";
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setSubmitting(true);
+    setError(null);
+    try {
+      const res = await apiFetch("/api/auth/login", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ username: username.trim(), password }),
+      });
+      if (!res.ok) {
+        setError(t("auth.invalidCredentials"));
+        return;
+      }
+      setPassword("");
+      onLoggedIn();
+    } catch {
+      setError(t("auth.networkError"));
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  return (
+    <div className={`app app-${theme} login-page`}>
+      <form className="system-panel login-panel" onSubmit={handleSubmit}>
+        <img src={ConsleeLogo} alt="Conslee" className="login-logo" />
+        <h2>{t("auth.title")}</h2>
+
+        {oidc && (
+          <a className="btn btn-primary login-sso" href={ssoHref}>
+            {t("auth.signInWith", { provider: oidc })}
+          </a>
+        )}
+
+        {oidc && passwordLogin && <div className="login-divider">{t("auth.or")}</div>}
+
+        {passwordLogin && (
+          <>
+            <div className="settings-row">
+              <label htmlFor="login-username">{t("auth.username")}</label>
+              <input
+                id="login-username"
+                type="text"
+                autoComplete="username"
+                autoFocus
+                value={username}
+                onChange={(e) => setUsername(e.target.value)}
+              />
+            </div>
+
+            <div className="settings-row">
+              <label htmlFor="login-password">{t("auth.password")}</label>
+              <input
+                id="login-password"
+                type="password"
+                autoComplete="current-password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+              />
+            </div>
+          </>
+        )}
+
+        {(error || ssoError) && (
+          <div className="settings-help error-text">{error ?? t(ssoError ?? "")}</div>
+        )}
+
+        {passwordLogin && (
+          <div className="system-footer">
+            <button
+              type="submit"
+              className="btn btn-primary"
+              disabled={submitting || !username.trim() || !password}
+            >
+              {submitting ? t("auth.signingIn") : t("auth.signIn")}
+            </button>
+          </div>
+        )}
+      </form>
+    </div>
+  );
+};
+
+export default LoginPage;
@@ -4,6 +4,7 @@ import ConsleeLogo from "../assets/conslee-logo.svg";
 
 type Props = {
   loading: boolean;
+  canManage: boolean;
   onShowCreate: () => void;
   onShowSystem: () => void;
   onToggleSidebar: () => void;
@@ -35,6 +36,7 @@ const SettingsIcon = () => (
 
 const MainHeader: React.FC<Props> = ({
   loading,
+  canManage,
   onShowCreate,
   onShowSystem,
   onToggleSidebar,
@@ -66,18 +68,22 @@ const MainHeader: React.FC<Props> = ({
           >
             <RefreshIcon />
           </div>
-          <button className="btn btn-ghost btn-with-icon" onClick={onShowCreate}>
-            <span className="btn-icon">
-              <PlusIcon />
-            </span>
-            {t("mainHeader.add")}
-          </button>
-          <button className="btn btn-ghost btn-with-icon" onClick={onShowSystem}>
-            <span className="btn-icon">
-              <SettingsIcon />
-            </span>
-            {t("mainHeader.system")}
-          </button>
+          {canManage && (
+            <>
+              <button className="btn btn-ghost btn-with-icon" onClick={onShowCreate}>
+                <span className="btn-icon">
+                  <PlusIcon />
+                </span>
+                {t("mainHeader.add")}
+              </button>
+              <button className="btn btn-ghost btn-with-icon" onClick={onShowSystem}>
+                <span className="btn-icon">
+                  <SettingsIcon />
+                </span>
+                {t("mainHeader.system")}
+              </button>
+            </>
+          )}
         </div>
       </header>
     </>
@@ -0,0 +1,117 @@
+import React, { useState } from "react";
+import { useI18n } from "../i18n/I18nContext";
+import { savingsQuery, useSavingsReport } from "../hooks/useSavingsReport";
+
+const dateString = (d: Date) => d.toISOString().slice(0, 10);
+
+const daysAgo = (n: number) => {
+  const d = new Date();
+  d.setUTCDate(d.getUTCDate() - n);
+  return dateString(d);
+};
+
+const fmt = (v: number, digits = 1) =>
+  v.toLocaleString(undefined, { minimumFractionDigits: digits, maximumFractionDigits: digits });
+
+const ReportsPage: React.FC = () => {
+  const { t } = useI18n();
+  const [from, setFrom] = useState(daysAgo(6));
+  const [to, setTo] = useState(daysAgo(0));
+  const { report, loading, error } = useSavingsReport(from, to);
+  const total = report?.total;
+
+  return (
+    <div className="audit-page reports-page">
+      <h1>{t("reports.title")}</h1>
+
+      <div className="audit-filters">
+        <label className="reports-date">
+          {t("reports.from")}
+          <input type="date" value={from} max={to} onChange={(e) => setFrom(e.target.value)} />
+        </label>
+        <label className="reports-date">
+          {t("reports.to")}
+          <input type="date" value={to} min={from} onChange={(e) => setTo(e.target.value)} />
+        </label>
+        <a
+          className="btn-ghost reports-export"
+          href={`/api/reports/savings?${savingsQuery(from, to)}&format=csv`}
+          download
+        >
+          {t("reports.exportCsv")}
+        </a>
+      </div>
+
+      {error && <div className="reports-error">{error}</div>}
+
+      {total && (
+        <div className="reports-totals">
+          <div className="reports-total">
+            <span className="reports-total-value">{fmt(total.uptimePercent)}%</span>
+            <span className="reports-total-label">{t("reports.uptime")}</span>
+          </div>
+          <div className="reports-total">
+            <span className="reports-total-value">{fmt(total.stoppedHours)}</span>
+            <span className="reports-total-label">{t("reports.stoppedHours")}</span>
+          </div>
+          <div className="reports-total">
+            <span className="reports-total-value">{total.wakes}</span>
+            <span className="reports-total-label">{t("reports.wakes")}</span>
+          </div>
+          <div className="reports-total">
+            <span className="reports-total-value">{fmt(total.cpuCoreHoursSaved)}</span>
+            <span className="reports-total-label">{t("reports.cpuSaved")}</span>
+          </div>
+          <div className="reports-total">
+            <span className="reports-total-value">{fmt(total.memoryGbHoursSaved)}</span>
+            <span className="reports-total-label">{t("reports.memorySaved")}</span>
+          </div>
+        </div>
+      )}
+
+      {!loading && (report?.services.length ?? 0) === 0 ? (
+        <div className="empty-state">{t("reports.empty")}</div>
+      ) : (
+        <table className="audit-table reports-table">
+          <thead>
+            <tr>
+              <th>{t("reports.service")}</th>
+              <th>{t("reports.runningHours")}</th>
+              <th>{t("reports.stoppedHours")}</th>
+              <th>{t("reports.uptime")}</th>
+              <th>{t("reports.wakes")}</th>
+              <th>{t("reports.avgCpu")}</th>
+              <th>{t("reports.avgMemory")}</th>
+              <th>{t("reports.cpuSaved")}</th>
+              <th>{t("reports.memorySaved")}</th>
+            </tr>
+          </thead>
+          <tbody>
+            {report?.services.map((s) => (
+              <tr key={s.service}>
+                <td>{s.service}</td>
+                <td>{fmt(s.runningHours)}</td>
+                <td>{fmt(s.stoppedHours)}</td>
+                <td>
+                  <div className="reports-uptime">
+                    <div className="reports-uptime-bar" style={{ width: `${s.uptimePercent}%` }} />
+                  </div>
+                  {fmt(s.uptimePercent)}%
+                </td>
+                <td>{s.wakes}</td>
+                <td>{fmt(s.avgCpuCores, 2)}</td>
+                <td>{fmt(s.avgMemoryMb, 0)}</td>
+                <td>{fmt(s.cpuCoreHoursSaved)}</td>
+                <td>{fmt(s.memoryGbHoursSaved)}</td>
+              </tr>
+            ))}
+          </tbody>
+        </table>
+      )}
+
+      <p className="reports-note">{t("reports.note")}</p>
+    </div>
+  );
+};
+
+export default ReportsPage;
@@ -3,6 +3,8 @@ import type { ServiceStatus } from "../types";
 import { useI18n } from "../i18n/I18nContext";
 import { isValidHost, isValidURL, isValidGoDuration } from "../utils/validation";
 import CustomDropdown from "./CustomDropdown";
+import ServiceTimeline from "./ServiceTimeline";
+import LogViewerModal from "./LogViewerModal";
 import { useProxyHealthCheck, useTargetHealthCheck } from "../hooks/useHealthChecks";
 import { useCardGridColumns } from "../hooks/useCardGridColumns";
 
@@ -94,6 +96,10 @@ const ServiceCard: React.FC<Props> = ({
   columnCount,
 }) => {
   const { t } = useI18n();
+  const canOperate = service.permissions?.operate ?? true;
+  const canDelete = service.permissions?.delete ?? true;
+  const [showHistory, setShowHistory] = useState(false);
+  const [showLogs, setShowLogs] = useState(false);
 
   const WEEK_DAYS = useMemo(() => 
     WEEK_DAY_KEYS.map((key) => ({
@@ -208,7 +214,11 @@ const ServiceCard: React.FC<Props> = ({
   const targetDisplay = service.targetUrl || "—";
   const hasProxyIssue = proxyHealth === "unhealthy";
   const hasTargetIssue = !hasProxyIssue && targetHealth === "unhealthy";
-  const statusBaseClass = service.running ? "status-running" : "status-stopped";
+  const statusBaseClass = service.waking
+    ? "status-waking"
+    : service.running
+      ? "status-running"
+      : "status-stopped";
   const statusIssueClass = hasProxyIssue
     ? "status-proxy-error"
     : hasTargetIssue
@@ -224,9 +234,11 @@ const ServiceCard: React.FC<Props> = ({
     ? proxyWarningTitle
     : hasTargetIssue
       ? targetWarningTitle
-      : service.running
-        ? t("serviceCard.running")
-        : t("serviceCard.stopped");
+      : service.waking
+        ? t("serviceCard.waking")
+        : service.running
+          ? t("serviceCard.running")
+          : t("serviceCard.stopped");
 
   const toggleDay = (key: string) => {
     const current = new Set(effectiveDays);
@@ -379,7 +391,7 @@ const ServiceCard: React.FC<Props> = ({
               type="button"
               className={`service-toggle-button ${serviceDisabled ? "service-toggle-button-off" : "service-toggle-button-on"}`}
               onClick={handleToggleEnabled}
-              disabled={saving}
+              disabled={saving || !canOperate}
               aria-pressed={!serviceDisabled}
               aria-label={t("serviceCard.toggleHelp")}
             >
@@ -467,26 +479,63 @@ const ServiceCard: React.FC<Props> = ({
             {formatLastActivity(service.lastActivity)}
           </span>
         </div>
-      </div>
 
-      <div className="card-footer">
-        <button className="btn btn-ghost" onClick={onToggleEditing}>
-          {isEditing ? t("serviceCard.hide") : t("serviceCard.settings")}
-        </button>
+        {!!service.suppressedWakes && (
+          <div className="card-row" title={t("serviceCard.suppressedWakesHelp")}>
+            <span className="card-row-icon">
+              <ActivityIcon />
+            </span>
+            <span className="label">{t("serviceCard.suppressedWakes")}</span>
+            <span className="value">{service.suppressedWakes}</span>
+          </div>
+        )}
+      </div>
 
+      <div className="card-history">
         <button
-          className={service.running ? "btn btn-secondary" : "btn btn-primary"}
-          disabled={saving}
-          onClick={() =>
-            service.running
-              ? onStop(service.name)
-              : onStart(service.name)
-          }
+          className="btn-ghost card-history-toggle"
+          aria-expanded={showHistory}
+          onClick={() => setShowHistory(!showHistory)}
         >
-          {service.running ? t("serviceCard.sleep") : t("serviceCard.wake")}
+          {showHistory ? t("serviceCard.hideHistory") : t("serviceCard.showHistory")}
         </button>
+        {showHistory && <ServiceTimeline service={service.name} />}
       </div>
 
+      {showLogs && (
+        <LogViewerModal
+          service={service.name}
+          containers={service.containers}
+          onClose={() => setShowLogs(false)}
+        />
+      )}
+
+      {canOperate && (
+        <div className="card-footer">
+          <button className="btn btn-ghost" onClick={onToggleEditing}>
+            {isEditing ? t("serviceCard.hide") : t("serviceCard.settings")}
+          </button>
+
+          {service.containers.length > 0 && (
+            <button className="btn btn-secondary" onClick={() => setShowLogs(true)}>
+              {t("serviceCard.logs")}
+            </button>
+          )}
+
+          <button
+            className={service.running ? "btn btn-secondary" : "btn btn-primary"}
+            disabled={saving}
+            onClick={() =>
+              service.running
+                ? onStop(service.name)
+                : onStart(service.name)
+            }
+          >
+            {service.running ? t("serviceCard.sleep") : t("serviceCard.wake")}
+          </button>
+        </div>
+      )}
+
       <div
         className={`settings-panel ${isEditing ? "settings-panel-open" : "settings-panel-closed"
           }`}
@@ -941,14 +990,16 @@ const ServiceCard: React.FC<Props> = ({
             </div>
           </div>
 
-          <div className="settings-row settings-row-danger">
-            <button
-              className="btn btn-danger"
-              onClick={() => onDelete(service.name)}
-            >
-              {t("serviceCard.deleteService")}
-            </button>
-          </div>
+          {canDelete && (
+            <div className="settings-row settings-row-danger">
+              <button
+                className="btn btn-danger"
+                onClick={() => onDelete(service.name)}
+              >
+                {t("serviceCard.deleteService")}
+              </button>
+            </div>
+          )}
         </div>
       </div>
     </article>
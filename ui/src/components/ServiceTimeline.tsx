@@ -0,0 +1,58 @@
+import React from "react";
+import { useI18n } from "../i18n/I18nContext";
+import { useServiceHistory } from "../hooks/useServiceHistory";
+import type { ServiceEvent } from "../types";
+
+type Props = {
+  service: string;
+};
+
+const formatTime = (iso: string) =>
+  new Date(iso).toLocaleString(undefined, {
+    month: "2-digit",
+    day: "2-digit",
+    hour: "2-digit",
+    minute: "2-digit",
+    second: "2-digit",
+    hour12: false,
+  });
+
+const ServiceTimeline: React.FC<Props> = ({ service }) => {
+  const { t } = useI18n();
+  const { events, loading } = useServiceHistory(service);
+
+  const describe = (e: ServiceEvent) => {
+    if (e.type === "container") {
+      return t("timeline.container", {
+        container: e.container ?? "",
+        state: t(`timeline.states.${e.state ?? "stopped"}`),
+      });
+    }
+    return t(`timeline.types.${e.type}`);
+  };
+
+  // Configuration changes carry the audit action, which has a translation.
+  const detail = (e: ServiceEvent) =>
+    e.type === "config-changed" && e.detail ? t(`audit.actions.${e.detail}`) : e.detail;
+
+  if (!loading && events.length === 0) {
+    return <div className="timeline-empty">{t("timeline.empty")}</div>;
+  }
+
+  return (
+    <ol className="timeline">
+      {events.map((e, i) => (
+        <li key={`${e.time}-${i}`} className={`timeline-item timeline-${e.type}`}>
+          <span className="timeline-dot" />
+          <span className="timeline-time">{formatTime(e.time)}</span>
+          <span className="timeline-text">
+            {describe(e)}
+            {detail(e) && <span className="timeline-detail">{detail(e)}</span>}
+          </span>
+        </li>
+      ))}
+    </ol>
+  );
+};
+
+export default ServiceTimeline;
@@ -3,6 +3,7 @@ import ConsleeLogo from "../assets/conslee-logo.svg";
 import type { Tab } from "../types";
 import { useI18n } from "../i18n/I18nContext";
 import LanguageSwitcher from "./LanguageSwitcher";
+import { useAuth } from "../auth/AuthContext";
 
 type Props = {
   tab: Tab;
@@ -16,6 +17,7 @@ type Props = {
 
 const Sidebar: React.FC<Props> = ({ tab, setTab, theme, setTheme, isOpen, onClose, onShowSupport }) => {
   const { t } = useI18n();
+  const { enabled: authEnabled, user, logout } = useAuth();
 
   return (
     <>
@@ -54,6 +56,24 @@ const Sidebar: React.FC<Props> = ({ tab, setTab, theme, setTheme, isOpen, onClos
           {t("sidebar.scheduled")}
         </button>
         <div className="tab-separator" />
+        <button
+          className={`tab ${tab === "audit" ? "tab-active" : ""}`}
+          onClick={() => {
+            setTab("audit");
+            onClose?.();
+          }}
+        >
+          {t("sidebar.audit")}
+        </button>
+        <button
+          className={`tab ${tab === "reports" ? "tab-active" : ""}`}
+          onClick={() => {
+            setTab("reports");
+            onClose?.();
+          }}
+        >
+          {t("sidebar.reports")}
+        </button>
         <button
           className={`tab ${tab === "help" ? "tab-active" : ""}`}
           onClick={() => {
@@ -82,6 +102,16 @@ const Sidebar: React.FC<Props> = ({ tab, setTab, theme, setTheme, isOpen, onClos
         >
           {theme === "dark" ? t("sidebar.darkTheme") : t("sidebar.lightTheme")}
         </button>
+        {authEnabled && user && (
+          <>
+            <div className="sidebar-user" title={user.name}>
+              {t("auth.signedInAs", { name: user.name })}
+            </div>
+            <button className="theme-toggle" onClick={logout}>
+              {t("auth.logout")}
+            </button>
+          </>
+        )}
       </div>
       {isOpen && (
         <button className="sidebar-close-button" onClick={onClose} aria-label="Close menu">
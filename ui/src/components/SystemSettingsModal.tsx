@@ -1,7 +1,8 @@
 import React, { useState, useRef, useEffect } from "react";
-import type { SystemStatus } from "../types";
+import type { LogFormat, LogLevel, SystemStatus } from "../types";
 import { useI18n } from "../i18n/I18nContext";
 import { isValidGoDuration } from "../utils/validation";
+import { apiFetch } from "../utils/api";
 
 type Props = {
   system: SystemStatus;
@@ -9,6 +10,9 @@ type Props = {
   onSave: (patch: Partial<SystemStatus>) => Promise<void>;
 };
 
+const LOG_LEVELS: LogLevel[] = ["debug", "info", "warn", "error"];
+const LOG_FORMATS: LogFormat[] = ["text", "json"];
+
 type PortStatus = "idle" | "checking" | "available" | "unavailable" | "error";
 
 const SystemSettingsModal: React.FC<Props> = ({ system, onClose, onSave }) => {
@@ -39,7 +43,7 @@ const SystemSettingsModal: React.FC<Props> = ({ system, onClose, onSave }) => {
     setPortError(null);
 
     try {
-      const res = await fetch(
+      const res = await apiFetch(
         `/api/system/check-port?listenAddr=${encodeURIComponent(addr)}`
       );
       if (!res.ok) {
@@ -209,6 +213,36 @@ const SystemSettingsModal: React.FC<Props> = ({ system, onClose, onSave }) => {
           )}
         </div>
 
+        <div className="settings-row">
+          <label>{t("systemSettings.logLevel")}</label>
+          <select
+            value={system.logLevel}
+            onChange={(e) => onSave({ logLevel: e.target.value as LogLevel })}
+          >
+            {LOG_LEVELS.map((l) => (
+              <option key={l} value={l}>
+                {t(`systemSettings.logLevels.${l}`)}
+              </option>
+            ))}
+          </select>
+          <div className="settings-help">{t("systemSettings.logLevelHelp")}</div>
+        </div>
+
+        <div className="settings-row">
+          <label>{t("systemSettings.logFormat")}</label>
+          <select
+            value={system.logFormat}
+            onChange={(e) => onSave({ logFormat: e.target.value as LogFormat })}
+          >
+            {LOG_FORMATS.map((f) => (
+              <option key={f} value={f}>
+                {t(`systemSettings.logFormats.${f}`)}
+              </option>
+            ))}
+          </select>
+          <div className="settings-help">{t("systemSettings.logFormatHelp")}</div>
+        </div>
+
         <div className="system-footer">
           <button className="btn btn-secondary" onClick={handleClose}>
             {t("systemSettings.close")}
@@ -0,0 +1,48 @@
+import { useState, useEffect, useCallback } from "react";
+import type { AuditEntry } from "../types";
+import { apiFetch } from "../utils/api";
+
+export type AuditFilter = {
+  service: string;
+  actor: string;
+  action: string;
+};
+
+/**
+ * Custom hook for fetching audit log entries matching a filter
+ */
+export function useAudit(filter: AuditFilter) {
+  const [entries, setEntries] = useState<AuditEntry[]>([]);
+  const [loading, setLoading] = useState(true);
+
+  const fetchAudit = useCallback(async () => {
+    const params = new URLSearchParams();
+    if (filter.service) params.set("service", filter.service);
+    if (filter.actor) params.set("actor", filter.actor);
+    if (filter.action) params.set("action", filter.action);
+    params.set("limit", "200");
+
+    try {
+      const res = await apiFetch(`/api/audit?${params.toString()}`);
+      if (!res.ok) return;
+      const data = await res.json();
+      setEntries(data);
+    } catch (e) {
+      console.error("Failed to load audit log", e);
+    } finally {
+      setLoading(false);
+    }
+  }, [filter.service, filter.actor, filter.action]);
+
+  useEffect(() => {
+    fetchAudit();
+
+    const id = setInterval(fetchAudit, 10000);
+
+    return () => {
+      clearInterval(id);
+    };
+  }, [fetchAudit]);
+
+  return { entries, loading, refetch: fetchAudit };
+}
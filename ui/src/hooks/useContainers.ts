@@ -1,15 +1,21 @@
-import { useState, useEffect } from "react";
+import { useState, useEffect, useRef } from "react";
 import type { DockerContainer } from "../types";
+import { apiFetch } from "../utils/api";
+import { useEvents } from "./useEvents";
+
+const RELOAD_DELAY_MS = 1000;
 
 /**
- * Custom hook for fetching and managing Docker containers
+ * Custom hook for fetching and managing Docker containers. The list is
+ * reloaded when containers start or stop.
  */
 export function useContainers() {
   const [containers, setContainers] = useState<DockerContainer[]>([]);
+  const reloadTimeoutRef = useRef<ReturnType<typeof setTimeout> | null>(null);
 
   const fetchContainers = async () => {
     try {
-      const res = await fetch("/api/docker/containers");
+      const res = await apiFetch("/api/docker/containers");
       if (!res.ok) return;
       const data = await res.json();
       setContainers(data);
@@ -18,13 +24,27 @@ export function useContainers() {
     }
   };
 
+  const scheduleReload = () => {
+    if (reloadTimeoutRef.current) return;
+    reloadTimeoutRef.current = setTimeout(() => {
+      reloadTimeoutRef.current = null;
+      fetchContainers();
+    }, RELOAD_DELAY_MS);
+  };
+
+  useEvents((event) => {
+    if (event.type === "container") {
+      scheduleReload();
+    }
+  }, scheduleReload);
+
   useEffect(() => {
     fetchContainers();
 
-    const id = setInterval(fetchContainers, 10000);
-
     return () => {
-      clearInterval(id);
+      if (reloadTimeoutRef.current) {
+        clearTimeout(reloadTimeoutRef.current);
+      }
     };
   }, []);
 
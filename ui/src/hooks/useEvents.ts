@@ -0,0 +1,24 @@
+import { useEffect, useRef } from "react";
+import type { ServiceEvent } from "../types";
+import { subscribeEvents } from "../utils/events";
+
+/**
+ * Calls onEvent for every event of the server's event stream, and onOpen
+ * whenever the stream (re)connects. The latest callbacks are used without
+ * resubscribing.
+ */
+export function useEvents(onEvent: (event: ServiceEvent) => void, onOpen?: () => void) {
+  const onEventRef = useRef(onEvent);
+  const onOpenRef = useRef(onOpen);
+  onEventRef.current = onEvent;
+  onOpenRef.current = onOpen;
+
+  useEffect(
+    () =>
+      subscribeEvents({
+        onEvent: (event) => onEventRef.current(event),
+        onOpen: () => onOpenRef.current?.(),
+      }),
+    []
+  );
+}
@@ -1,17 +1,48 @@
 import { useEffect, useState } from "react";
-import type { ServiceStatus } from "../types";
+import type { ServiceEvent, ServiceStatus } from "../types";
+import { apiFetch } from "../utils/api";
+import { useEvents } from "./useEvents";
+
+// Probes are repeated when the event stream reports a change of the
+// service. A backend can still fail without one, so they are also repeated
+// on this slower interval.
+const PROBE_INTERVAL_MS = 60000;
+
+const PROBE_EVENTS: ServiceEvent["type"][] = [
+  "ready",
+  "failed",
+  "idle-stopped",
+  "schedule-stopped",
+  "config-changed",
+  "container",
+];
 
-const PROBE_INTERVAL_MS = 10000;
+/**
+ * Counts the events that may change the health of a service, so probes can
+ * depend on it.
+ */
+function useProbeTrigger(serviceName: string) {
+  const [trigger, setTrigger] = useState(0);
+  useEvents(
+    (event) => {
+      if (event.service === serviceName && PROBE_EVENTS.includes(event.type)) {
+        setTrigger((n) => n + 1);
+      }
+    },
+    () => setTrigger((n) => n + 1)
+  );
+  return trigger;
+}
 
 type ProbePayload = {
-  url: string;
-  expectHost?: string;
-  allowWake?: boolean;
-  requireSignature?: boolean;
+  service: string;
+  target: "proxy" | "upstream";
 };
 
 type ProbeResponse = {
   status: "healthy" | "unhealthy";
+  latencyMs: number;
+  signature: boolean;
 };
 
 const performServerProbe = async (
@@ -22,7 +53,7 @@ const performServerProbe = async (
   controllers.add(controller);
 
   try {
-    const response = await fetch("/api/probes", {
+    const response = await apiFetch("/api/probes", {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
@@ -49,6 +80,7 @@ const performServerProbe = async (
  */
 export function useProxyHealthCheck(service: ServiceStatus) {
   const [proxyHealth, setProxyHealth] = useState<"healthy" | "unhealthy" | null>(null);
+  const trigger = useProbeTrigger(service.name);
 
   useEffect(() => {
     if (!service.enabled) {
@@ -66,26 +98,11 @@ export function useProxyHealthCheck(service: ServiceStatus) {
 
     let cancelled = false;
     const controllers = new Set<AbortController>();
-    const protocol = window.location.protocol === "https:" ? "https:" : "http:";
-    const healthPath = (service.healthPath || "").trim();
-    const normalizedPath = healthPath
-      ? healthPath.startsWith("/")
-        ? healthPath
-        : `/${healthPath}`
-      : "/";
-    const url = `${protocol}//${host}${normalizedPath}`;
-    const expectHost = host.toLowerCase();
-    const allowWake = false;
 
     const runProxyCheck = async () => {
       try {
         const status = await performServerProbe(
-          {
-            url,
-            expectHost,
-            allowWake,
-            requireSignature: true,
-          },
+          { service: service.name, target: "proxy" },
           controllers,
         );
         if (!cancelled) {
@@ -106,7 +123,7 @@ export function useProxyHealthCheck(service: ServiceStatus) {
       controllers.forEach((controller) => controller.abort());
       window.clearInterval(intervalId);
     };
-  }, [service.enabled, service.host, service.targetUrl, service.healthPath]);
+  }, [service.enabled, service.name, service.host, service.targetUrl, service.healthPath, trigger]);
 
   return proxyHealth;
 }
@@ -119,6 +136,7 @@ export function useTargetHealthCheck(
   proxyHealth: "healthy" | "unhealthy" | null,
 ) {
   const [targetHealth, setTargetHealth] = useState<"healthy" | "unhealthy" | null>(null);
+  const trigger = useProbeTrigger(service.name);
 
   useEffect(() => {
     if (!service.enabled) {
@@ -144,39 +162,13 @@ export function useTargetHealthCheck(
       return;
     }
 
-    let targetToCheck = baseTarget;
-    try {
-      const baseUrl = new URL(baseTarget);
-      const healthPath = (service.healthPath || "").trim();
-      if (healthPath) {
-        targetToCheck = new URL(
-          healthPath.startsWith("/") ? healthPath : `/${healthPath}`,
-          baseUrl,
-        ).toString();
-      } else {
-        targetToCheck = baseUrl.toString();
-      }
-    } catch {
-      targetToCheck = baseTarget;
-    }
-
     let cancelled = false;
     const controllers = new Set<AbortController>();
-    let expectHost = "";
-    try {
-      expectHost = new URL(targetToCheck).host.toLowerCase();
-    } catch {
-      expectHost = "";
-    }
 
     const runTargetCheck = async () => {
       try {
         const status = await performServerProbe(
-          {
-            url: targetToCheck,
-            expectHost,
-            allowWake: true,
-          },
+          { service: service.name, target: "upstream" },
           controllers,
         );
         if (!cancelled) {
@@ -199,11 +191,13 @@ export function useTargetHealthCheck(
     };
   }, [
     service.enabled,
+    service.name,
     service.running,
     service.targetUrl,
     service.healthPath,
     service.host,
     proxyHealth,
+    trigger,
   ]);
 
   return targetHealth;
@@ -0,0 +1,52 @@
+import { useState, useEffect, useCallback } from "react";
+import type { SavingsReport } from "../types";
+import { apiFetch } from "../utils/api";
+
+/**
+ * Query string of the savings report for a range of dates (YYYY-MM-DD,
+ * both included)
+ */
+export function savingsQuery(from: string, to: string): string {
+  const params = new URLSearchParams();
+  if (from) params.set("from", from);
+  if (to) params.set("to", to);
+  return params.toString();
+}
+
+/**
+ * Custom hook for fetching the uptime and resource savings report
+ */
+export function useSavingsReport(from: string, to: string) {
+  const [report, setReport] = useState<SavingsReport | null>(null);
+  const [loading, setLoading] = useState(true);
+  const [error, setError] = useState<string | null>(null);
+
+  const fetchReport = useCallback(async () => {
+    try {
+      const res = await apiFetch(`/api/reports/savings?${savingsQuery(from, to)}`);
+      if (!res.ok) {
+        setError((await res.text()).trim());
+        return;
+      }
+      setReport(await res.json());
+      setError(null);
+    } catch (e) {
+      console.error("Failed to load savings report", e);
+    } finally {
+      setLoading(false);
+    }
+  }, [from, to]);
+
+  useEffect(() => {
+    fetchReport();
+
+    // Usage is sampled once a minute.
+    const id = setInterval(fetchReport, 60000);
+
+    return () => {
+      clearInterval(id);
+    };
+  }, [fetchReport]);
+
+  return { report, loading, error, refetch: fetchReport };
+}
@@ -0,0 +1,56 @@
+import { useState, useEffect, useCallback, useRef } from "react";
+import type { ServiceEvent } from "../types";
+import { apiFetch } from "../utils/api";
+import { useEvents } from "./useEvents";
+
+const HISTORY_LIMIT = 50;
+// Events often come in bursts (one per container), so reloads are batched.
+const RELOAD_DELAY_MS = 300;
+
+/**
+ * Custom hook for fetching the event history of a service. It is reloaded
+ * when the event stream reports something about the service.
+ */
+export function useServiceHistory(service: string) {
+  const [events, setEvents] = useState<ServiceEvent[]>([]);
+  const [loading, setLoading] = useState(true);
+  const reloadTimeoutRef = useRef<ReturnType<typeof setTimeout> | null>(null);
+
+  const fetchHistory = useCallback(async () => {
+    try {
+      const res = await apiFetch(
+        `/api/services/${encodeURIComponent(service)}/events?limit=${HISTORY_LIMIT}`
+      );
+      if (!res.ok) return;
+      setEvents(await res.json());
+    } catch (e) {
+      console.error("Failed to load event history", e);
+    } finally {
+      setLoading(false);
+    }
+  }, [service]);
+
+  const scheduleReload = () => {
+    if (reloadTimeoutRef.current) return;
+    reloadTimeoutRef.current = setTimeout(() => {
+      reloadTimeoutRef.current = null;
+      fetchHistory();
+    }, RELOAD_DELAY_MS);
+  };
+
+  useEffect(() => {
+    fetchHistory();
+    return () => {
+      if (reloadTimeoutRef.current) {
+        clearTimeout(reloadTimeoutRef.current);
+        reloadTimeoutRef.current = null;
+      }
+    };
+  }, [fetchHistory]);
+
+  useEvents((event) => {
+    if (event.service === service) scheduleReload();
+  }, scheduleReload);
+
+  return { events, loading };
+}
@@ -1,14 +1,22 @@
 import { useState, useEffect, useRef } from "react";
-import type { ServiceStatus } from "../types";
+import type { ServiceEvent, ServiceStatus } from "../types";
+import { apiFetch } from "../utils/api";
+import { useEvents } from "./useEvents";
+
+// Events often come in bursts (one per container), so reloads are batched.
+const RELOAD_DELAY_MS = 300;
 
 /**
- * Custom hook for fetching and managing services with minimum loading duration
+ * Custom hook for fetching and managing services with minimum loading duration.
+ * The list is reloaded when the event stream reports a change.
  */
 export function useServices() {
   const [services, setServices] = useState<ServiceStatus[]>([]);
   const [loading, setLoading] = useState(true);
   const loadingStartTimeRef = useRef<number | null>(null);
   const loadingTimeoutRef = useRef<ReturnType<typeof setTimeout> | null>(null);
+  const reloadTimeoutRef = useRef<ReturnType<typeof setTimeout> | null>(null);
+  const wakingRef = useRef<Set<string>>(new Set());
 
   const setLoadingWithMinDuration = (value: boolean) => {
     if (value) {
@@ -42,7 +50,7 @@ export function useServices() {
     try {
       setLoadingWithMinDuration(true);
 
-      const res = await fetch("/api/services");
+      const res = await apiFetch("/api/services");
       if (!res.ok) {
         throw new Error(`HTTP ${res.status}`);
       }
@@ -69,6 +77,7 @@ export function useServices() {
               stop: s.schedule.stop ?? "",
             }
           : undefined,
+        waking: wakingRef.current.has(s.name),
       }));
 
       setServices(normalized);
@@ -79,16 +88,48 @@ export function useServices() {
     }
   };
 
+  const scheduleReload = () => {
+    if (reloadTimeoutRef.current) return;
+    reloadTimeoutRef.current = setTimeout(() => {
+      reloadTimeoutRef.current = null;
+      fetchServices();
+    }, RELOAD_DELAY_MS);
+  };
+
+  const setWaking = (name: string, waking: boolean) => {
+    if (waking) {
+      wakingRef.current.add(name);
+    } else {
+      wakingRef.current.delete(name);
+    }
+    setServices((prev) =>
+      prev.map((s) => (s.name === name ? { ...s, waking } : s))
+    );
+  };
+
+  const handleEvent = (event: ServiceEvent) => {
+    if (event.service && (event.type === "waking" || event.type === "ready" || event.type === "failed")) {
+      setWaking(event.service, event.type === "waking");
+    }
+    if (event.type !== "waking") {
+      scheduleReload();
+    }
+  };
+
+  // The stream reports changes from now on; anything before (or while it
+  // was disconnected) is picked up by reloading.
+  useEvents(handleEvent, scheduleReload);
+
   useEffect(() => {
     fetchServices();
 
-    const id = setInterval(fetchServices, 10000);
-
     return () => {
-      clearInterval(id);
       if (loadingTimeoutRef.current) {
         clearTimeout(loadingTimeoutRef.current);
       }
+      if (reloadTimeoutRef.current) {
+        clearTimeout(reloadTimeoutRef.current);
+      }
     };
   }, []);
 
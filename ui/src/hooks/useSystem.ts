@@ -1,15 +1,18 @@
 import { useState, useEffect } from "react";
 import type { SystemStatus } from "../types";
+import { apiFetch } from "../utils/api";
+import { useEvents } from "./useEvents";
 
 /**
- * Custom hook for fetching and managing system status
+ * Custom hook for fetching and managing system status. It is reloaded when
+ * the event stream reports a change of the system settings.
  */
 export function useSystem() {
   const [system, setSystem] = useState<SystemStatus | null>(null);
 
   const fetchSystem = async () => {
     try {
-      const res = await fetch("/api/system");
+      const res = await apiFetch("/api/system");
       if (!res.ok) return;
       const data = await res.json();
       setSystem(data);
@@ -18,14 +21,14 @@ export function useSystem() {
     }
   };
 
+  useEvents((event) => {
+    if (event.type === "config-changed" && !event.service) {
+      fetchSystem();
+    }
+  });
+
   useEffect(() => {
     fetchSystem();
-
-    const id = setInterval(fetchSystem, 10000);
-
-    return () => {
-      clearInterval(id);
-    };
   }, []);
 
   return { system, refetch: fetchSystem };
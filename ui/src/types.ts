@@ -18,6 +18,36 @@ export type ServiceStatus = {
     targetUrl: string;
     healthPath: string;
     schedule?: ServiceSchedule;
+    owners?: string[];
+    labels?: Record<string, string>;
+    permissions?: ServicePermissions;
+    suppressedWakes?: number;
+    // Set from the event stream while the service is being started.
+    waking?: boolean;
+};
+
+export type ServiceEventType =
+    | "waking"
+    | "ready"
+    | "idle-stopped"
+    | "schedule-stopped"
+    | "failed"
+    | "config-changed"
+    | "container";
+
+export type ServiceEvent = {
+    id: number;
+    type: ServiceEventType;
+    time: string;
+    service?: string;
+    container?: string;
+    state?: "running" | "stopped" | "paused";
+    detail?: string;
+};
+
+export type ServicePermissions = {
+    operate: boolean;
+    delete: boolean;
 };
 
 type DockerPort = {
@@ -40,6 +70,47 @@ export type DockerContainer = {
 export type SystemStatus = {
     listenAddr: string;
     idleReaperInterval: string;
+    logLevel: LogLevel;
+    logFormat: LogFormat;
+};
+
+export type LogLevel = "debug" | "info" | "warn" | "error";
+export type LogFormat = "text" | "json";
+
+export type Tab = "all" | "running" | "scheduled" | "audit" | "reports" | "help";
+
+export type ServiceSavings = {
+  service: string;
+  runningHours: number;
+  stoppedHours: number;
+  uptimePercent: number;
+  wakes: number;
+  avgCpuCores: number;
+  avgMemoryMb: number;
+  cpuCoreHoursUsed: number;
+  cpuCoreHoursSaved: number;
+  memoryGbHoursUsed: number;
+  memoryGbHoursSaved: number;
+};
+
+export type SavingsReport = {
+  from: string;
+  to: string;
+  services: ServiceSavings[];
+  total: ServiceSavings;
 };
 
-export type Tab = "all" | "running" | "scheduled" | "help";
+export type AuditChange = {
+  field: string;
+  before?: unknown;
+  after?: unknown;
+};
+
+export type AuditEntry = {
+  time: string;
+  actor: string;
+  action: string;
+  service?: string;
+  detail?: string;
+  changes?: AuditChange[];
+};
@@ -0,0 +1,46 @@
+export const UNAUTHORIZED_EVENT = "conslee:unauthorized";
+
+/**
+ * Where to continue after signing in. Protected services send users to the
+ * login page with an rd parameter; the server checks it before redirecting.
+ */
+export function returnTo(): string | null {
+  return new URLSearchParams(window.location.search).get("rd");
+}
+
+export function continueURL(rd: string): string {
+  return `/api/auth/continue?rd=${encodeURIComponent(rd)}`;
+}
+
+const CSRF_COOKIE = "conslee_csrf";
+const SAFE_METHODS = ["GET", "HEAD", "OPTIONS"];
+
+/**
+ * The CSRF token the server issued with the session (or, without
+ * authentication, on the first /api/auth/me call).
+ */
+function csrfToken(): string | null {
+  const prefix = `${CSRF_COOKIE}=`;
+  const cookie = document.cookie.split("; ").find((c) => c.startsWith(prefix));
+  return cookie ? decodeURIComponent(cookie.slice(prefix.length)) : null;
+}
+
+/**
+ * fetch wrapper for management API calls. State-changing requests carry the
+ * CSRF token. A 401 response means the session has expired, so the app is
+ * told to show the login page again.
+ */
+export async function apiFetch(input: string, init?: RequestInit): Promise<Response> {
+  const method = (init?.method ?? "GET").toUpperCase();
+  const headers = new Headers(init?.headers);
+  const token = csrfToken();
+  if (!SAFE_METHODS.includes(method) && token) {
+    headers.set("X-CSRF-Token", token);
+  }
+
+  const res = await fetch(input, { credentials: "same-origin", ...init, headers });
+  if (res.status === 401 && !input.startsWith("/api/auth/")) {
+    window.dispatchEvent(new Event(UNAUTHORIZED_EVENT));
+  }
+  return res;
+}
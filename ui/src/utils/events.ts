@@ -0,0 +1,78 @@
+import type { ServiceEvent, ServiceEventType } from "../types";
+
+const EVENT_TYPES: ServiceEventType[] = [
+  "waking",
+  "ready",
+  "idle-stopped",
+  "schedule-stopped",
+  "failed",
+  "config-changed",
+  "container",
+];
+
+// Browsers give up on an EventSource after an error response such as 401;
+// it is reopened after this delay.
+const REOPEN_DELAY_MS = 5000;
+
+type Listener = {
+  onEvent: (event: ServiceEvent) => void;
+  onOpen?: () => void;
+};
+
+const listeners = new Set<Listener>();
+let source: EventSource | null = null;
+let reopenTimer: ReturnType<typeof setTimeout> | null = null;
+
+function open() {
+  const es = new EventSource("/api/events", { withCredentials: true });
+  source = es;
+
+  for (const type of EVENT_TYPES) {
+    es.addEventListener(type, (msg) => {
+      let event: ServiceEvent;
+      try {
+        event = JSON.parse((msg as MessageEvent).data);
+      } catch {
+        return;
+      }
+      listeners.forEach((l) => l.onEvent(event));
+    });
+  }
+
+  // Also fired after automatic reconnects: events may have been missed, so
+  // listeners reload their state.
+  es.onopen = () => listeners.forEach((l) => l.onOpen?.());
+
+  es.onerror = () => {
+    if (es.readyState !== EventSource.CLOSED) return;
+    es.close();
+    if (source === es) source = null;
+    if (listeners.size > 0 && !reopenTimer) {
+      reopenTimer = setTimeout(() => {
+        reopenTimer = null;
+        if (listeners.size > 0 && !source) open();
+      }, REOPEN_DELAY_MS);
+    }
+  };
+}
+
+/**
+ * Subscribes to GET /api/events. All subscribers share one connection,
+ * which is closed when the last one unsubscribes.
+ */
+export function subscribeEvents(listener: Listener): () => void {
+  listeners.add(listener);
+  if (!source) open();
+
+  return () => {
+    listeners.delete(listener);
+    if (listeners.size === 0) {
+      source?.close();
+      source = null;
+      if (reopenTimer) {
+        clearTimeout(reopenTimer);
+        reopenTimer = null;
+      }
+    }
+  };
+}
@@ -13,6 +13,8 @@ export const isValidHost = (s: string): boolean => {
   };
   
   export const isValidURL = (s: string): boolean => {
+    // unix:///path/to.sock with an optional ":/http/path" suffix
+    if (/^unix:\/\/\/[^:\s]+(:\/\S*)?$/.test(s.trim())) return true;
     try {
       const u = new URL(s);
       return u.protocol === "http:" || u.protocol === "https:";